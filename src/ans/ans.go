@@ -0,0 +1,29 @@
+// Package ans реализует энтропийное кодирование rANS (range asymmetric numeral systems)
+// со статическими таблицами частот: Writer накапливает символы, при закрытии нормирует
+// их частоты к сумме 2^TableLog, записывает таблицу частот и закодированные символы.
+// Декодирование символа - одно обращение к таблице размера 2^TableLog, как в табличном
+// декодере Хаффмана, а сжатие близко к арифметическому кодированию.
+//
+// Символы кодируются несколькими чередующимися состояниями rANS (Options.Streams):
+// символ i кодируется состоянием i % Streams, а байты всех состояний идут в одном потоке.
+// Цепочки вычислений разных состояний независимы, поэтому процессор выполняет их параллельно.
+//
+// Формат потока: количество символов (uvarint); если оно не равно 0 - TableLog (4 бита),
+// Streams-1 (3 бита), таблица частот, выравнивание до байта, конечные состояния
+// кодера (по 32 бита), длина потока байтов (uvarint) и сами байты.
+// Пустой поток (без символов) не содержит ни одного байта.
+package ans
+
+import "errors"
+
+var (
+	// ErrCorrupt возвращается, если сжатый поток не мог быть создан Writer.
+	ErrCorrupt = errors.New("ans: corrupt data")
+	// ErrTruncated возвращается, если сжатый поток закончился раньше, чем ожидалось.
+	ErrTruncated = errors.New("ans: truncated data")
+)
+
+const (
+	// Состояние rANS лежит в [ransLow, ransLow<<8) и нормализуется побайтно.
+	ransLow = 1 << 23
+)
@@ -0,0 +1,182 @@
+package ans
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/farit2000/compressor/src/bitio"
+)
+
+// encode сжимает data кодом rANS с параметрами o.
+func encode(t *testing.T, data []byte, o *Options) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriterOptions(&buf, o)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decode распаковывает stream, созданный с параметрами o.
+func decode(stream []byte, o *Options) ([]byte, error) {
+	return ioutil.ReadAll(NewReaderOptions(bytes.NewReader(stream), o))
+}
+
+func TestRoundTripTestData(t *testing.T) {
+	files, err := filepath.Glob("../../testData/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for streams := 1; streams <= MaxStreams; streams++ {
+			for _, tableLog := range []int{MinTableLog, 9, DefaultTableLog, MaxTableLog} {
+				o := &Options{Streams: streams, TableLog: tableLog}
+				got, err := decode(encode(t, data, o), o)
+				if err != nil {
+					t.Fatalf("%s, streams %d, table log %d: %v", name, streams, tableLog, err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("%s, streams %d, table log %d: data mismatch", name, streams, tableLog)
+				}
+			}
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	stream := encode(t, nil, nil)
+	if len(stream) != 0 {
+		t.Fatalf("empty input compressed to %d bytes", len(stream))
+	}
+	if _, err := NewReader(bytes.NewReader(nil)).ReadByte(); err != io.EOF {
+		t.Fatalf("empty stream: got %v, want io.EOF", err)
+	}
+}
+
+// testStream возвращает сжатый normSmall.txt с несколькими состояниями.
+func testStream(t *testing.T) (data, stream []byte) {
+	data, err := ioutil.ReadFile("../../testData/normSmall.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, encode(t, data, &Options{Streams: 3})
+}
+
+// dataOffset возвращает позицию размера байтов rANS в stream и сам размер.
+func dataOffset(t *testing.T, stream []byte) (pos, size int) {
+	r := NewReader(bytes.NewReader(stream))
+	if err := r.readHeader(); err != nil {
+		t.Fatal(err)
+	}
+	size = len(r.data)
+	var buf [binary.MaxVarintLen64]byte
+	return len(stream) - size - binary.PutUvarint(buf[:], uint64(size)), size
+}
+
+func TestTruncated(t *testing.T) {
+	_, stream := testStream(t)
+	for n := 1; n < len(stream); n++ {
+		if _, err := decode(stream[:n], nil); !errors.Is(err, ErrTruncated) {
+			t.Fatalf("stream truncated to %d of %d bytes: got %v, want ErrTruncated", n, len(stream), err)
+		}
+	}
+}
+
+func TestFinalState(t *testing.T) {
+	_, stream := testStream(t)
+	// Количество символов на 1 меньше: последнее состояние не вернется к начальному
+	n, k := binary.Uvarint(stream)
+	var buf [binary.MaxVarintLen64]byte
+	short := append(buf[:binary.PutUvarint(buf[:], n-1)], stream[k:]...)
+	if _, err := decode(short, nil); !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), "final rANS state") {
+		t.Fatalf("one symbol less: got %v, want ErrCorrupt for the final state", err)
+	}
+}
+
+func TestBytesLeft(t *testing.T) {
+	data, stream := testStream(t)
+	pos, size := dataOffset(t, stream)
+	var buf [binary.MaxVarintLen64]byte
+	long := append([]byte(nil), stream[:pos]...)
+	long = append(long, buf[:binary.PutUvarint(buf[:], uint64(size+1))]...)
+	long = append(long, stream[len(stream)-size:]...)
+	long = append(long, 0)
+	got, err := decode(long, nil)
+	if !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), "bytes left") {
+		t.Fatalf("extra byte: got %v, want ErrCorrupt for bytes left", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("extra byte: symbols before the error differ")
+	}
+}
+
+func TestBitFlips(t *testing.T) {
+	data, stream := testStream(t)
+	pos, _ := dataOffset(t, stream)
+	// Состояния (3 по 4 байта) записаны перед размером байтов rANS
+	statesPos := pos - 3*4
+	corrupt := make([]byte, len(stream))
+	for i := range stream {
+		for bit := uint(0); bit < 8; bit++ {
+			copy(corrupt, stream)
+			corrupt[i] ^= 1 << bit
+			// Повреждение таблицы, не нарушившее сумму частот, может незаметно поменять символы
+			// (контрольные суммы проверяет fd), а повреждение состояний и байтов rANS
+			// должны обнаружить проверки finish.
+			got, err := decode(corrupt, nil)
+			if err == nil && i >= statesPos {
+				t.Errorf("bit %d of byte %d (states start at %d): corruption not detected", bit, i, statesPos)
+			}
+			if err == nil && i < statesPos && len(got) != len(data) {
+				t.Errorf("bit %d of byte %d: decoded %d symbols without an error, want %d", bit, i, len(got), len(data))
+			}
+		}
+	}
+}
+
+func TestTableSum(t *testing.T) {
+	const tableLog = 6
+	for _, freqs := range [][]uint32{
+		{10, 20, 33},     // меньше 2^tableLog
+		{10, 20, 34, 1},  // больше 2^tableLog
+		{0, 64, 0, 1, 0}, // больше 2^tableLog
+	} {
+		var buf bytes.Buffer
+		bw := bitio.NewWriter(&buf)
+		if err := writeTable(bw, freqs); err != nil {
+			t.Fatal(err)
+		}
+		bw.Close()
+		_, err := readTable(bitio.NewReader(&buf), len(freqs), tableLog)
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("frequencies %v: got %v, want ErrCorrupt", freqs, err)
+		}
+	}
+	// Таблица с неверной суммой внутри потока
+	var buf bytes.Buffer
+	bw := bitio.NewWriter(&buf)
+	bw.TryWriteUvarint(3)
+	bw.TryWriteBits(tableLog, 4)
+	bw.TryWriteBits(0, 3)
+	if err := writeTable(bw, []uint32{10, 20, 33}); err != nil {
+		t.Fatal(err)
+	}
+	bw.Close()
+	if _, err := decode(buf.Bytes(), nil); !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), "sum") {
+		t.Fatalf("stream with a bad table: got %v, want ErrCorrupt for the sum", err)
+	}
+}
@@ -0,0 +1,81 @@
+package ans
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+const (
+	// DefaultAlphabetSize - размер алфавита по умолчанию: все значения байта.
+	DefaultAlphabetSize = 256
+	// MinTableLog и MaxTableLog - пределы логарифма суммы нормированных частот.
+	MinTableLog = 5
+	MaxTableLog = 15
+	// DefaultTableLog - логарифм суммы нормированных частот по умолчанию.
+	DefaultTableLog = 12
+	// MaxAlphabetSize - наибольший размер алфавита: каждый встречающийся символ
+	// должен получить ненулевую частоту.
+	MaxAlphabetSize = 1 << MaxTableLog
+	// MaxStreams - наибольшее количество чередующихся состояний rANS.
+	MaxStreams = 8
+	// DefaultStreams - количество чередующихся состояний по умолчанию.
+	DefaultStreams = 4
+)
+
+type Options struct {
+	// AlphabetSize - количество различных значений символов: кодируются значения [0, AlphabetSize).
+	// 0 означает байты (256 значений). Значения больше 256 можно записывать только через
+	// Writer.WriteSymbol и читать через Reader.ReadSymbol. Не больше MaxAlphabetSize.
+	AlphabetSize int
+	// TableLog - логарифм суммы нормированных частот, от MinTableLog до MaxTableLog.
+	// Большие значения точнее передают частоты, но увеличивают таблицы декодера.
+	// 0 означает DefaultTableLog. Если встречающихся символов больше 2^TableLog,
+	// значение увеличивается. Записывается в поток, декодеру не нужно.
+	TableLog int
+	// Streams - количество чередующихся состояний rANS, от 1 до MaxStreams.
+	// 0 означает DefaultStreams. Записывается в поток, декодеру не нужно.
+	Streams int
+}
+
+// checkOptions возвращает новые параметры, в которых "отсутствующие" поля (с нулевым значением) устанавливаются в значения по умолчанию.
+// Переданные параметры не изменяются.
+// Разрешено передавать nil, который рассматривается как нулевое значение Options.
+func checkOptions(o *Options) *Options {
+	o2 := new(Options)
+	if o != nil {
+		*o2 = *o
+	}
+	if o2.AlphabetSize <= 0 {
+		o2.AlphabetSize = DefaultAlphabetSize
+	}
+	if o2.TableLog == 0 {
+		o2.TableLog = DefaultTableLog
+	}
+	if o2.Streams == 0 {
+		o2.Streams = DefaultStreams
+	}
+	return o2
+}
+
+// validate проверяет параметры, обработанные checkOptions.
+func (o *Options) validate() error {
+	if o.AlphabetSize > MaxAlphabetSize {
+		return fmt.Errorf("ans: alphabet size %d exceeds %d", o.AlphabetSize, MaxAlphabetSize)
+	}
+	if o.TableLog < MinTableLog || o.TableLog > MaxTableLog {
+		return fmt.Errorf("ans: table log %d is out of range [%d, %d]", o.TableLog, MinTableLog, MaxTableLog)
+	}
+	if o.Streams < 1 || o.Streams > MaxStreams {
+		return fmt.Errorf("ans: number of streams %d is out of range [1, %d]", o.Streams, MaxStreams)
+	}
+	return nil
+}
+
+// tableLogFor возвращает логарифм суммы частот не меньше tableLog, при котором
+// каждый из used встречающихся символов получит ненулевую частоту.
+func tableLogFor(tableLog, used int) int {
+	if min := bits.Len(uint(used - 1)); tableLog < min {
+		return min
+	}
+	return tableLog
+}
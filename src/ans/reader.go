@@ -0,0 +1,179 @@
+package ans
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/farit2000/compressor/src/bitio"
+)
+
+// Reader - это реализация считывателя rANS.
+// Он также реализует io.ByteReader.
+type Reader struct {
+	br           *bitio.Reader
+	alphabetSize int
+	started      bool   // Сообщает, прочитан ли заголовок потока
+	left         uint64 // Количество еще не декодированных символов
+	n            int    // Количество декодированных символов
+	tableLog     uint8
+	streams      int
+	table        []slot   // Таблица декодирования
+	states       []uint32 // Состояния rANS
+	data         []byte   // Непрочитанные байты потока
+	err          error    // Ошибка в параметрах или первая ошибка декодирования
+}
+
+// NewReader возвращает новый Reader, используя указанный io.Reader в качестве ввода (источника),
+// с параметрами по умолчанию.
+func NewReader(in io.Reader) *Reader {
+	return NewReaderOptions(in, nil)
+}
+
+// NewReaderOptions возвращает новый Reader, используя указанный io.Reader в качестве входа (источника)
+// с указанными опциями. Из опций используется только AlphabetSize.
+func NewReaderOptions(in io.Reader, o *Options) *Reader {
+	o = checkOptions(o)
+	r := &Reader{br: bitio.NewReader(in), alphabetSize: o.AlphabetSize}
+	if o.AlphabetSize > MaxAlphabetSize {
+		r.err = fmt.Errorf("ans: alphabet size %d exceeds %d", o.AlphabetSize, MaxAlphabetSize)
+	}
+	return r
+}
+
+// Чтение распаковывает до len (p) байтов из источника.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	for i := range p {
+		if p[i], err = r.ReadByte(); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+// ReadByte распаковывает один байт.
+// Если размер алфавита больше 256, символы за пределами байта возвращаются как ErrCorrupt,
+// такие потоки нужно читать через ReadSymbol.
+func (r *Reader) ReadByte() (byte, error) {
+	s, err := r.ReadSymbol()
+	if err != nil {
+		return 0, err
+	}
+	if s > 255 {
+		return 0, fmt.Errorf("%w: symbol %d does not fit in a byte", ErrCorrupt, s)
+	}
+	return byte(s), nil
+}
+
+// ReadSymbol распаковывает один символ.
+// Возвращает io.EOF после последнего символа, а также если поток пуст.
+func (r *Reader) ReadSymbol() (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if !r.started {
+		if r.err = r.readHeader(); r.err != nil {
+			return 0, r.err
+		}
+		r.started = true
+	}
+	if r.left == 0 {
+		r.err = r.finish()
+		if r.err == nil {
+			r.err = io.EOF
+		}
+		return 0, r.err
+	}
+	r.left--
+	i := r.n % r.streams
+	r.n++
+	mask := uint32(1)<<r.tableLog - 1
+	x := r.states[i]
+	sl := &r.table[x&mask]
+	x = sl.freq*(x>>r.tableLog) + x&mask - sl.start
+	for x < ransLow {
+		if len(r.data) == 0 {
+			r.err = ErrTruncated
+			return 0, r.err
+		}
+		x = x<<8 | uint32(r.data[0])
+		r.data = r.data[1:]
+	}
+	r.states[i] = x
+	return int(sl.symbol), nil
+}
+
+// readHeader читает количество символов, таблицу частот, состояния и поток байтов.
+func (r *Reader) readHeader() error {
+	br := r.br
+	n, err := br.ReadUvarint()
+	if err != nil {
+		if err == io.EOF {
+			return io.EOF // пустой поток
+		}
+		return noEOF(err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: stream of 0 symbols", ErrCorrupt)
+	}
+	r.left = n
+	tableLog := br.TryReadBits(4)
+	streams := br.TryReadBits(3) + 1
+	if br.TryError != nil {
+		return noEOF(br.TryError)
+	}
+	if tableLog < MinTableLog || tableLog > MaxTableLog {
+		return fmt.Errorf("%w: table log %d", ErrCorrupt, tableLog)
+	}
+	r.tableLog, r.streams = uint8(tableLog), int(streams)
+	freqs, err := readTable(br, r.alphabetSize, int(tableLog))
+	if err != nil {
+		return err
+	}
+	r.table = newDecTable(freqs, int(tableLog))
+	br.Align()
+	r.states = make([]uint32, r.streams)
+	for i := range r.states {
+		x, err := br.ReadBits(32)
+		if err != nil {
+			return noEOF(err)
+		}
+		if x < ransLow || x >= ransLow<<8 {
+			return fmt.Errorf("%w: invalid rANS state %#x", ErrCorrupt, x)
+		}
+		r.states[i] = uint32(x)
+	}
+	size, err := br.ReadUvarint()
+	if err != nil {
+		return noEOF(err)
+	}
+	// Размер может быть поврежден, поэтому буфер растет по мере чтения, а не выделяется заранее
+	var buf bytes.Buffer
+	if _, err = io.CopyN(&buf, br, int64(size)); err != nil {
+		return noEOF(err)
+	}
+	r.data = buf.Bytes()
+	return nil
+}
+
+// finish проверяет, что после последнего символа состояния вернулись к начальным,
+// а все байты потока прочитаны: так обнаруживается большинство повреждений.
+func (r *Reader) finish() error {
+	for _, x := range r.states {
+		if x != ransLow {
+			return fmt.Errorf("%w: final rANS state %#x", ErrCorrupt, x)
+		}
+	}
+	if len(r.data) != 0 {
+		return fmt.Errorf("%w: %d bytes left after the last symbol", ErrCorrupt, len(r.data))
+	}
+	return nil
+}
+
+// noEOF заменяет конец данных посреди потока на ErrTruncated.
+func noEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF || err == bitio.ErrTruncated {
+		return ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package ans
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/farit2000/compressor/src/bitio"
+)
+
+// Normalize масштабирует частоты counts так, чтобы их сумма была равна 2^tableLog,
+// а каждый встречающийся символ (counts[s] > 0) получил частоту не меньше 1.
+// Количество встречающихся символов не должно превышать 2^tableLog.
+func Normalize(counts []int, tableLog int) []uint32 {
+	freqs := make([]uint32, len(counts))
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return freqs
+	}
+	m := 1 << tableLog
+	sum := 0
+	var used []int // Встречающиеся символы
+	for s, c := range counts {
+		if c == 0 {
+			continue
+		}
+		f := int(uint64(c) * uint64(m) / uint64(total))
+		if f == 0 {
+			f = 1
+		}
+		freqs[s] = uint32(f)
+		sum += f
+		used = append(used, s)
+	}
+	// Устойчивая сортировка по убыванию частоты: одинаковые частоты всегда дают одинаковую таблицу.
+	sort.SliceStable(used, func(i, j int) bool { return counts[used[i]] > counts[used[j]] })
+	if sum < m {
+		// Округление вниз потеряло часть суммы - отдаем ее самому частому символу
+		freqs[used[0]] += uint32(m - sum)
+		return freqs
+	}
+	// Частоты, поднятые до 1, превысили сумму - забираем лишнее у частых символов,
+	// не опуская их ниже 1
+	for sum > m {
+		for _, s := range used {
+			if sum == m {
+				break
+			}
+			if freqs[s] > 1 {
+				take := int(freqs[s]-1) / 4
+				if take == 0 {
+					take = 1
+				}
+				if take > sum-m {
+					take = sum - m
+				}
+				freqs[s] -= uint32(take)
+				sum -= take
+			}
+		}
+	}
+	return freqs
+}
+
+// writeTable записывает нормированные частоты: количество встречающихся символов
+// (гамма-код), а для каждого из них - количество пропущенных перед ним символов
+// с нулевой частотой (Exp-Golomb порядка 0) и частоту (гамма-код).
+func writeTable(bw *bitio.Writer, freqs []uint32) error {
+	used := 0
+	for _, f := range freqs {
+		if f > 0 {
+			used++
+		}
+	}
+	bw.TryWriteGamma(uint64(used))
+	gap := 0
+	for _, f := range freqs {
+		if f == 0 {
+			gap++
+			continue
+		}
+		bw.TryWriteExpGolomb(uint64(gap), 0)
+		bw.TryWriteGamma(uint64(f))
+		gap = 0
+	}
+	return bw.TryError
+}
+
+// readTable читает частоты, записанные writeTable, и проверяет, что их сумма равна 2^tableLog.
+func readTable(br *bitio.Reader, alphabetSize, tableLog int) ([]uint32, error) {
+	used, err := br.ReadGamma()
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if used > uint64(alphabetSize) {
+		return nil, fmt.Errorf("%w: %d symbols in the table of %d symbols", ErrCorrupt, used, alphabetSize)
+	}
+	freqs := make([]uint32, alphabetSize)
+	s, sum := 0, uint64(0)
+	for i := uint64(0); i < used; i++ {
+		gap, err := br.ReadExpGolomb(0)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		f, err := br.ReadGamma()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		if gap >= uint64(alphabetSize-s) {
+			return nil, fmt.Errorf("%w: symbol is outside the alphabet of %d symbols", ErrCorrupt, alphabetSize)
+		}
+		s += int(gap)
+		if sum += f; sum > 1<<tableLog {
+			return nil, fmt.Errorf("%w: frequencies exceed %d", ErrCorrupt, 1<<tableLog)
+		}
+		freqs[s] = uint32(f)
+		s++
+	}
+	if sum != 1<<tableLog {
+		return nil, fmt.Errorf("%w: frequencies sum to %d, expected %d", ErrCorrupt, sum, 1<<tableLog)
+	}
+	return freqs, nil
+}
+
+// slot - элемент таблицы декодирования: символ, которому принадлежит значение
+// младших TableLog битов состояния, его частота и начало его интервала.
+type slot struct {
+	symbol uint16
+	freq   uint32
+	start  uint32
+}
+
+// encSymbol - параметры кодирования символа.
+type encSymbol struct {
+	freq  uint32
+	start uint32
+	max   uint32 // Состояние, начиная с которого перед кодированием символа нужно вывести байт
+}
+
+// newEncTable возвращает параметры кодирования всех символов.
+func newEncTable(freqs []uint32, tableLog int) []encSymbol {
+	table := make([]encSymbol, len(freqs))
+	start := uint32(0)
+	for s, f := range freqs {
+		table[s] = encSymbol{freq: f, start: start, max: (ransLow >> uint(tableLog) << 8) * f}
+		start += f
+	}
+	return table
+}
+
+// newDecTable возвращает таблицу декодирования размера 2^tableLog.
+func newDecTable(freqs []uint32, tableLog int) []slot {
+	table := make([]slot, 0, 1<<tableLog)
+	for s, f := range freqs {
+		start := uint32(len(table))
+		for i := uint32(0); i < f; i++ {
+			table = append(table, slot{symbol: uint16(s), freq: f, start: start})
+		}
+	}
+	return table
+}
@@ -0,0 +1,134 @@
+package ans
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/farit2000/compressor/src/bitio"
+)
+
+// Writer - это реализация модуля записи rANS.
+// Накапливает все символы и записывает их при закрытии, поэтому должен быть закрыт.
+type Writer struct {
+	bw           *bitio.Writer
+	alphabetSize int
+	tableLog     int
+	streams      int
+	values       []uint16 // Записанные символы
+	counts       []int    // Частоты символов
+	err          error    // Ошибка в параметрах, возвращается всеми вызовами
+}
+
+// NewWriter возвращает новый Writer, используя указанный io.Writer в качестве вывода,
+// с параметрами по умолчанию.
+func NewWriter(out io.Writer) *Writer {
+	return NewWriterOptions(out, nil)
+}
+
+// NewWriterOptions возвращает новый Writer с указанными параметрами.
+// Reader правильно декодирует поток, только если он создан с тем же AlphabetSize.
+// Ошибка в параметрах будет возвращена первым вызовом Write, WriteSymbol или Close.
+func NewWriterOptions(out io.Writer, o *Options) *Writer {
+	o = checkOptions(o)
+	w := &Writer{bw: bitio.NewWriter(out), alphabetSize: o.AlphabetSize, tableLog: o.TableLog, streams: o.Streams}
+	if w.err = o.validate(); w.err != nil {
+		return w
+	}
+	w.counts = make([]int, o.AlphabetSize)
+	return w
+}
+
+// Write записывает p. Данные сжимаются и записываются при закрытии Writer.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	for i, b := range p {
+		if err = w.WriteByte(b); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+// WriteByte записывает b. Данные сжимаются и записываются при закрытии Writer.
+func (w *Writer) WriteByte(b byte) error {
+	return w.WriteSymbol(int(b))
+}
+
+// WriteSymbol записывает символ s, лежащий в пределах [0, Options.AlphabetSize).
+// Данные сжимаются и записываются при закрытии Writer.
+func (w *Writer) WriteSymbol(s int) error {
+	if w.err != nil {
+		return w.err
+	}
+	if s < 0 || s >= w.alphabetSize {
+		return fmt.Errorf("ans: symbol %d is outside the alphabet of %d symbols", s, w.alphabetSize)
+	}
+	w.values = append(w.values, uint16(s))
+	w.counts[s]++
+	return nil
+}
+
+// Close нормирует частоты накопленных символов, записывает таблицу частот и
+// закодированные символы. Базовый io.Writer не закрывается.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(w.values) > 0 {
+		if err := w.encode(); err != nil {
+			return err
+		}
+		w.values = w.values[:0]
+		for s := range w.counts {
+			w.counts[s] = 0
+		}
+	}
+	return w.bw.Close()
+}
+
+// encode записывает накопленные символы.
+func (w *Writer) encode() error {
+	used := 0
+	for _, c := range w.counts {
+		if c > 0 {
+			used++
+		}
+	}
+	tableLog := tableLogFor(w.tableLog, used)
+	freqs := Normalize(w.counts, tableLog)
+	enc := newEncTable(freqs, tableLog)
+
+	// Символы кодируются с конца: rANS работает как стек, и декодер получит их в прямом порядке.
+	// Байты выводятся в обратном порядке, поэтому в конце поток переворачивается.
+	var states [MaxStreams]uint32
+	for i := range states {
+		states[i] = ransLow
+	}
+	buf := make([]byte, 0, len(w.values)/2)
+	for i := len(w.values) - 1; i >= 0; i-- {
+		e := &enc[w.values[i]]
+		x := states[i%w.streams]
+		for x >= e.max {
+			buf = append(buf, byte(x))
+			x >>= 8
+		}
+		states[i%w.streams] = x/e.freq<<uint(tableLog) + x%e.freq + e.start
+	}
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+
+	bw := w.bw
+	bw.TryWriteUvarint(uint64(len(w.values)))
+	bw.TryWriteBits(uint64(tableLog), 4)
+	bw.TryWriteBits(uint64(w.streams-1), 3)
+	if err := writeTable(bw, freqs); err != nil {
+		return err
+	}
+	bw.TryAlign()
+	for _, x := range states[:w.streams] {
+		bw.TryWriteBits(uint64(x), 32)
+	}
+	bw.TryWriteUvarint(uint64(len(buf)))
+	bw.TryWrite(buf)
+	return bw.TryError
+}
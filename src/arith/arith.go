@@ -0,0 +1,17 @@
+// Package arith реализует адаптивное арифметическое (интервальное) кодирование
+// символов - альтернативу кодированию Хаффмана для последнего этапа сжатия.
+// В отличие от кода Хаффмана, символ с вероятностью больше 1/2 занимает меньше бита,
+// что важно для выхода MTF, где номер 0 (или RUNA/RUNB) встречается очень часто.
+//
+// Вероятности символов оценивает модель (Options.Model), которая одинаково
+// обновляется в Writer и Reader, поэтому в поток не записываются никакие таблицы.
+package arith
+
+import "errors"
+
+var (
+	// ErrCorrupt возвращается, если сжатый поток не мог быть создан Writer.
+	ErrCorrupt = errors.New("arith: corrupt data")
+	// ErrTruncated возвращается, если сжатый поток закончился до символа EOF.
+	ErrTruncated = errors.New("arith: truncated data")
+)
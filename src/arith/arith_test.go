@@ -0,0 +1,181 @@
+package arith
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// testModels - все модели вероятностей.
+var testModels = []Model{Order0, MTFRanks}
+
+// encode сжимает data арифметическим кодом с параметрами o.
+func encode(t *testing.T, data []byte, o *Options) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriterOptions(&buf, o)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decode распаковывает stream, созданный с параметрами o.
+func decode(stream []byte, o *Options) ([]byte, error) {
+	return ioutil.ReadAll(NewReaderOptions(bytes.NewReader(stream), o))
+}
+
+func TestRoundTripTestData(t *testing.T) {
+	files, err := filepath.Glob("../../testData/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range testModels {
+			o := &Options{Model: m}
+			got, err := decode(encode(t, data, o), o)
+			if err != nil {
+				t.Fatalf("%s, model %v: %v", name, m, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%s, model %v: data mismatch", name, m)
+			}
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	for _, m := range testModels {
+		o := &Options{Model: m}
+		if stream := encode(t, nil, o); len(stream) != 0 {
+			t.Errorf("model %v: empty input compressed to %d bytes", m, len(stream))
+		}
+		if _, err := NewReaderOptions(bytes.NewReader(nil), o).ReadSymbol(); err != io.EOF {
+			t.Errorf("model %v: empty stream: got %v, want io.EOF", m, err)
+		}
+	}
+}
+
+func TestSingleSymbol(t *testing.T) {
+	for _, m := range testModels {
+		o := &Options{Model: m}
+		for _, n := range []int{1, 2, 100000} {
+			data := bytes.Repeat([]byte{'a'}, n)
+			stream := encode(t, data, o)
+			got, err := decode(stream, o)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("model %v, %d symbols: got %d symbols, %v", m, n, len(got), err)
+			}
+			// Вероятность повторяющегося символа близка к 1, и он занимает меньше бита
+			if n == 100000 && len(stream) > n/8 {
+				t.Errorf("model %v: %d equal symbols compressed to %d bytes", m, n, len(stream))
+			}
+		}
+	}
+}
+
+func TestLargeAlphabet(t *testing.T) {
+	const alphabetSize = 1000
+	symbols := make([]int, 5000)
+	for i := range symbols {
+		symbols[i] = (alphabetSize - 1 - i*7919) % alphabetSize
+		if symbols[i] < 0 {
+			symbols[i] += alphabetSize
+		}
+	}
+	for _, m := range testModels {
+		o := &Options{Model: m, AlphabetSize: alphabetSize}
+		var buf bytes.Buffer
+		w := NewWriterOptions(&buf, o)
+		for _, s := range symbols {
+			if err := w.WriteSymbol(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.WriteSymbol(alphabetSize); err == nil {
+			t.Errorf("model %v: symbol %d outside the alphabet was written", m, alphabetSize)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r := NewReaderOptions(bytes.NewReader(buf.Bytes()), o)
+		for i, s := range symbols {
+			if got, err := r.ReadSymbol(); err != nil || got != s {
+				t.Fatalf("model %v, symbol %d: got %d, %v; want %d", m, i, got, err, s)
+			}
+		}
+		if _, err := r.ReadSymbol(); err != io.EOF {
+			t.Fatalf("model %v: got %v after the last symbol, want io.EOF", m, err)
+		}
+		// Первый символ 999 не помещается в байт
+		if _, err := NewReaderOptions(bytes.NewReader(buf.Bytes()), o).ReadByte(); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("model %v: ReadByte of symbol %d: got %v, want ErrCorrupt", m, symbols[0], err)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	for _, o := range []*Options{{AlphabetSize: MaxAlphabetSize + 1}, {Model: 3}} {
+		if err := NewWriterOptions(ioutil.Discard, o).WriteByte(0); err == nil {
+			t.Errorf("options %+v: Writer accepted invalid options", *o)
+		}
+		if _, err := NewReaderOptions(bytes.NewReader([]byte{0, 0, 0, 0, 0}), o).ReadByte(); err == nil {
+			t.Errorf("options %+v: Reader accepted invalid options", *o)
+		}
+	}
+}
+
+// testStream возвращает normSmall.txt и его сжатую форму.
+func testStream(t *testing.T, m Model) (data, stream []byte) {
+	data, err := ioutil.ReadFile("../../testData/normSmall.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, encode(t, data, &Options{Model: m})
+}
+
+func TestTruncated(t *testing.T) {
+	for _, m := range testModels {
+		o := &Options{Model: m}
+		_, stream := testStream(t, m)
+		for n := 1; n < len(stream); n++ {
+			if _, err := decode(stream[:n], o); !errors.Is(err, ErrTruncated) {
+				t.Fatalf("model %v, stream truncated to %d of %d bytes: got %v, want ErrTruncated", m, n, len(stream), err)
+			}
+		}
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	for _, m := range testModels {
+		o := &Options{Model: m}
+		_, stream := testStream(t, m)
+		corrupt := make([]byte, len(stream))
+		for i := range stream {
+			for bit := uint(0); bit < 8; bit++ {
+				copy(corrupt, stream)
+				corrupt[i] ^= 1 << bit
+				// Арифметический код не хранит контрольных сумм (их проверяет fd), поэтому
+				// поврежденный поток может распаковаться в другие символы, но декодер
+				// должен остановиться с ErrCorrupt, ErrTruncated или на символе EOF.
+				_, err := decode(corrupt, o)
+				if i == 0 && !errors.Is(err, ErrCorrupt) {
+					t.Errorf("model %v, bit %d of the first byte: got %v, want ErrCorrupt", m, bit, err)
+				}
+				if err != nil && !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrTruncated) {
+					t.Errorf("model %v, bit %d of byte %d: unexpected error %v", m, bit, i, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package arith
+
+import "math/bits"
+
+// model оценивает вероятности символов [0, n) и кодирует их интервальным кодером.
+// Writer и Reader обновляют модель одинаково после каждого символа.
+type model interface {
+	encode(e *encoder, s int)
+	decode(d *decoder) (int, error)
+}
+
+// newModel создает модель m для n символов.
+func newModel(m Model, n int) model {
+	if m == Order0 {
+		return newOrder0Model(n)
+	}
+	return newRankModel(n)
+}
+
+const (
+	// order0Increment - приращение частоты символа после его кодирования.
+	order0Increment = 32
+)
+
+// order0Model - адаптивная модель нулевого порядка (Order0).
+type order0Model struct {
+	freq  []uint32 // Частоты символов, не меньше 1
+	total uint32   // Сумма частот
+}
+
+func newOrder0Model(n int) *order0Model {
+	m := &order0Model{freq: make([]uint32, n), total: uint32(n)}
+	for s := range m.freq {
+		m.freq[s] = 1
+	}
+	return m
+}
+
+func (m *order0Model) encode(e *encoder, s int) {
+	start := uint32(0)
+	for _, f := range m.freq[:s] {
+		start += f
+	}
+	e.encodeFreq(start, m.freq[s], m.total)
+	m.update(s)
+}
+
+func (m *order0Model) decode(d *decoder) (int, error) {
+	f, err := d.decodeFreq(m.total)
+	if err != nil {
+		return 0, err
+	}
+	s, start := 0, uint32(0)
+	for ; start+m.freq[s] <= f; s++ {
+		start += m.freq[s]
+	}
+	d.consumeFreq(start, m.freq[s])
+	m.update(s)
+	return s, nil
+}
+
+// update увеличивает частоту символа s, уменьшая все частоты вдвое при переполнении.
+func (m *order0Model) update(s int) {
+	m.freq[s] += order0Increment
+	m.total += order0Increment
+	if m.total > maxTotal {
+		m.total = 0
+		for i, f := range m.freq {
+			m.freq[i] = (f + 1) / 2
+			m.total += m.freq[i]
+		}
+	}
+}
+
+// rankModel - модель номеров MTF (MTFRanks).
+// Группа символа s - bits.Len(s): группа 0 - символ 0, группа g > 0 - символы [2^(g-1), 2^g).
+type rankModel struct {
+	n       int
+	groups  int      // Количество групп
+	last    int      // Группа предыдущего символа - контекст выбора группы
+	choice  [][]prob // choice[last][g] - вероятность того, что символ не лежит в группе g (при условии, что он не в меньших группах)
+	offsets [][]prob // offsets[g] - двоичное дерево вероятностей смещения в группе g
+}
+
+func newRankModel(n int) *rankModel {
+	m := &rankModel{n: n, groups: bits.Len(uint(n-1)) + 1}
+	m.choice = make([][]prob, m.groups)
+	for i := range m.choice {
+		m.choice[i] = newProbs(m.groups - 1)
+	}
+	m.offsets = make([][]prob, m.groups)
+	for g := 2; g < m.groups; g++ {
+		m.offsets[g] = newProbs(1 << (g - 1))
+	}
+	return m
+}
+
+// newProbs возвращает n вероятностей 1/2.
+func newProbs(n int) []prob {
+	p := make([]prob, n)
+	for i := range p {
+		p[i] = newProb
+	}
+	return p
+}
+
+func (m *rankModel) encode(e *encoder, s int) {
+	g := bits.Len(uint(s))
+	choice := m.choice[m.last]
+	for i := 0; i < m.groups-1; i++ {
+		if i == g {
+			e.encodeBit(&choice[i], 0)
+			break
+		}
+		e.encodeBit(&choice[i], 1)
+	}
+	if g >= 2 {
+		// Смещение в группе - g-1 битов, начиная со старшего
+		tree, node := m.offsets[g], 1
+		for i := g - 2; i >= 0; i-- {
+			bit := s >> uint(i) & 1
+			e.encodeBit(&tree[node], bit)
+			node = node<<1 | bit
+		}
+	}
+	m.last = g
+}
+
+func (m *rankModel) decode(d *decoder) (int, error) {
+	choice := m.choice[m.last]
+	g := 0
+	for g < m.groups-1 && d.decodeBit(&choice[g]) == 1 {
+		g++
+	}
+	s := g
+	if g >= 2 {
+		tree, node := m.offsets[g], 1
+		for i := g - 2; i >= 0; i-- {
+			node = node<<1 | d.decodeBit(&tree[node])
+		}
+		s = node
+	}
+	if s >= m.n {
+		return 0, ErrCorrupt
+	}
+	m.last = g
+	return s, nil
+}
@@ -0,0 +1,74 @@
+package arith
+
+import "fmt"
+
+// DefaultAlphabetSize - размер алфавита по умолчанию: все значения байта.
+const DefaultAlphabetSize = 256
+
+// MaxAlphabetSize - наибольший размер алфавита: частоты модели Order0 должны
+// помещаться в maxTotal вместе с символом EOF.
+const MaxAlphabetSize = maxTotal/2 - 1
+
+// Model - способ оценки вероятностей символов.
+type Model byte
+
+const (
+	// Order0 - адаптивная модель нулевого порядка: частоты всех символов алфавита,
+	// которые увеличиваются после каждого символа и периодически уменьшаются вдвое,
+	// чтобы модель следила за изменением статистики.
+	Order0 Model = iota + 1
+	// MTFRanks - модель для номеров MTF (и символов ZRLE): символ s раскладывается
+	// на номер группы bits.Len(s) (0, 1, 2-3, 4-7, ...) и смещение в группе.
+	// Группа кодируется цепочкой двоичных решений в контексте группы предыдущего символа,
+	// смещение - двоичным деревом вероятностей своей группы. Малые номера, которые
+	// встречаются чаще всего, так кодируются одним-двумя хорошо предсказуемыми битами.
+	MTFRanks
+)
+
+// String возвращает название модели.
+func (m Model) String() string {
+	switch m {
+	case Order0:
+		return "order0"
+	case MTFRanks:
+		return "mtf"
+	}
+	return fmt.Sprintf("unknown (%d)", byte(m))
+}
+
+type Options struct {
+	// AlphabetSize - количество различных значений символов: кодируются значения [0, AlphabetSize).
+	// 0 означает байты (256 значений). Значения больше 256 можно записывать только через
+	// Writer.WriteSymbol и читать через Reader.ReadSymbol. Не больше MaxAlphabetSize.
+	AlphabetSize int
+	// Model - модель вероятностей символов. 0 означает MTFRanks.
+	Model Model
+}
+
+// checkOptions возвращает новые параметры, в которых "отсутствующие" поля (с нулевым значением) устанавливаются в значения по умолчанию.
+// Переданные параметры не изменяются.
+// Разрешено передавать nil, который рассматривается как нулевое значение Options.
+func checkOptions(o *Options) *Options {
+	o2 := new(Options)
+	if o != nil {
+		*o2 = *o
+	}
+	if o2.AlphabetSize <= 0 {
+		o2.AlphabetSize = DefaultAlphabetSize
+	}
+	if o2.Model == 0 {
+		o2.Model = MTFRanks
+	}
+	return o2
+}
+
+// validate проверяет параметры, обработанные checkOptions.
+func (o *Options) validate() error {
+	if o.AlphabetSize > MaxAlphabetSize {
+		return fmt.Errorf("arith: alphabet size %d exceeds %d", o.AlphabetSize, MaxAlphabetSize)
+	}
+	if o.Model != Order0 && o.Model != MTFRanks {
+		return fmt.Errorf("arith: unknown model %d", o.Model)
+	}
+	return nil
+}
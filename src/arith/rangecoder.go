@@ -0,0 +1,185 @@
+package arith
+
+import "io"
+
+// Интервальный кодер в стиле LZMA: 32-битный интервал, 33-битная нижняя граница
+// и отложенный вывод байтов 0xFF на случай переноса.
+const (
+	topValue = 1 << 24 // Интервал нормализуется, как только становится меньше topValue
+	probBits = 12      // Точность вероятностей двоичных решений
+	probOne  = 1 << probBits
+	fastBits = 4       // Скорость адаптации быстрой оценки вероятности
+	slowBits = 7       // Скорость адаптации медленной оценки вероятности
+	maxTotal = 1 << 16 // Наибольшая сумма частот для encodeFreq
+)
+
+// prob - адаптивная вероятность того, что двоичное решение равно 0, в единицах 1/probOne:
+// среднее двух оценок, быстро и медленно следящих за статистикой.
+type prob struct {
+	fast, slow uint16
+}
+
+// newProb - вероятность 1/2.
+var newProb = prob{probOne / 2, probOne / 2}
+
+// value возвращает вероятность нуля.
+func (p *prob) value() uint32 {
+	return (uint32(p.fast) + uint32(p.slow)) / 2
+}
+
+// update учитывает двоичное решение bit.
+func (p *prob) update(bit int) {
+	if bit == 0 {
+		p.fast += (probOne - p.fast) >> fastBits
+		p.slow += (probOne - p.slow) >> slowBits
+	} else {
+		p.fast -= p.fast >> fastBits
+		p.slow -= p.slow >> slowBits
+	}
+}
+
+// encoder - кодирующая часть интервального кодера.
+type encoder struct {
+	out       io.ByteWriter
+	low       uint64 // Нижняя граница интервала (33 бита, старший - перенос)
+	rng       uint32 // Ширина интервала
+	cache     byte   // Последний невыведенный байт
+	cacheSize int64  // Количество невыведенных байтов: cache и следующие за ним 0xFF
+	err       error  // Первая ошибка записи
+}
+
+func newEncoder(out io.ByteWriter) *encoder {
+	return &encoder{out: out, rng: 0xFFFFFFFF, cacheSize: 1}
+}
+
+// shiftLow выводит старший байт нижней границы, учитывая возможный перенос.
+func (e *encoder) shiftLow() {
+	if uint32(e.low) < 0xFF000000 || e.low >= 1<<32 {
+		carry := byte(e.low >> 32)
+		for b := e.cache; e.cacheSize > 0; e.cacheSize-- {
+			if err := e.out.WriteByte(b + carry); err != nil && e.err == nil {
+				e.err = err
+			}
+			b = 0xFF
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = e.low & 0x00FFFFFF << 8
+}
+
+// normalize расширяет интервал, выводя байты нижней границы.
+func (e *encoder) normalize() {
+	for e.rng < topValue {
+		e.rng <<= 8
+		e.shiftLow()
+	}
+}
+
+// encodeBit кодирует двоичное решение bit с вероятностью *p и обновляет *p.
+func (e *encoder) encodeBit(p *prob, bit int) {
+	bound := e.rng >> probBits * p.value()
+	if bit == 0 {
+		e.rng = bound
+	} else {
+		e.low += uint64(bound)
+		e.rng -= bound
+	}
+	p.update(bit)
+	e.normalize()
+}
+
+// encodeFreq кодирует символ, занимающий частоты [start, start+size) из total (total <= maxTotal).
+func (e *encoder) encodeFreq(start, size, total uint32) {
+	e.rng /= total
+	e.low += uint64(start) * uint64(e.rng)
+	e.rng *= size
+	e.normalize()
+}
+
+// flush выводит нижнюю границу, достаточную для декодирования всех символов.
+func (e *encoder) flush() error {
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+	return e.err
+}
+
+// decoder - декодирующая часть интервального кодера.
+type decoder struct {
+	in   io.ByteReader
+	code uint32 // Положение кода внутри интервала
+	rng  uint32 // Ширина интервала
+	err  error  // Первая ошибка чтения; после нее декодер получает нулевые байты
+}
+
+// newDecoder читает начало потока. Возвращает io.EOF, если поток пуст.
+func newDecoder(in io.ByteReader) (*decoder, error) {
+	d := &decoder{in: in, rng: 0xFFFFFFFF}
+	b, err := in.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if b != 0 {
+		// Первый байт кодера - начальное значение cache - всегда 0
+		return nil, ErrCorrupt
+	}
+	for i := 0; i < 4; i++ {
+		d.code = d.code<<8 | uint32(d.readByte())
+	}
+	return d, d.err
+}
+
+// readByte читает следующий байт; конец потока запоминается как ErrTruncated.
+func (d *decoder) readByte() byte {
+	b, err := d.in.ReadByte()
+	if err != nil && d.err == nil {
+		if err == io.EOF {
+			err = ErrTruncated
+		}
+		d.err = err
+	}
+	return b
+}
+
+// normalize расширяет интервал, дочитывая байты кода.
+func (d *decoder) normalize() {
+	for d.rng < topValue {
+		d.rng <<= 8
+		d.code = d.code<<8 | uint32(d.readByte())
+	}
+}
+
+// decodeBit декодирует двоичное решение с вероятностью *p и обновляет *p.
+func (d *decoder) decodeBit(p *prob) int {
+	bound := d.rng >> probBits * p.value()
+	bit := 0
+	if d.code < bound {
+		d.rng = bound
+	} else {
+		d.code -= bound
+		d.rng -= bound
+		bit = 1
+	}
+	p.update(bit)
+	d.normalize()
+	return bit
+}
+
+// decodeFreq возвращает частоту, на которую указывает код, для суммы частот total.
+// После поиска символа нужно вызвать consumeFreq.
+func (d *decoder) decodeFreq(total uint32) (uint32, error) {
+	d.rng /= total
+	f := d.code / d.rng
+	if f >= total {
+		return 0, ErrCorrupt
+	}
+	return f, nil
+}
+
+// consumeFreq удаляет из кода символ, занимающий частоты [start, start+size).
+func (d *decoder) consumeFreq(start, size uint32) {
+	d.code -= start * d.rng
+	d.rng *= size
+	d.normalize()
+}
@@ -0,0 +1,100 @@
+package arith
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Reader - это реализация считывателя арифметического кода.
+// Он также реализует io.ByteReader.
+type Reader struct {
+	in           io.ByteReader
+	dec          *decoder // Декодер, создается при чтении первого символа
+	model        model
+	alphabetSize int
+	eof          bool  // Сообщает, был ли прочитан символ EOF
+	err          error // Ошибка в параметрах или первая ошибка декодирования
+}
+
+// NewReader возвращает новый Reader, используя указанный io.Reader в качестве ввода (источника),
+// с параметрами по умолчанию.
+func NewReader(in io.Reader) *Reader {
+	return NewReaderOptions(in, nil)
+}
+
+// NewReaderOptions возвращает новый Reader, используя указанный io.Reader в качестве входа (источника)
+// с указанными опциями.
+func NewReaderOptions(in io.Reader, o *Options) *Reader {
+	o = checkOptions(o)
+	bin, ok := in.(io.ByteReader)
+	if !ok {
+		bin = bufio.NewReader(in)
+	}
+	r := &Reader{in: bin, alphabetSize: o.AlphabetSize}
+	if r.err = o.validate(); r.err != nil {
+		return r
+	}
+	r.model = newModel(o.Model, o.AlphabetSize+1)
+	return r
+}
+
+// Чтение распаковывает до len (p) байтов из источника.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	for i := range p {
+		if p[i], err = r.ReadByte(); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+// ReadByte распаковывает один байт.
+// Если размер алфавита больше 256, символы за пределами байта возвращаются как ErrCorrupt,
+// такие потоки нужно читать через ReadSymbol.
+func (r *Reader) ReadByte() (byte, error) {
+	s, err := r.ReadSymbol()
+	if err != nil {
+		return 0, err
+	}
+	if s > 255 {
+		return 0, fmt.Errorf("%w: symbol %d does not fit in a byte", ErrCorrupt, s)
+	}
+	return byte(s), nil
+}
+
+// ReadSymbol распаковывает один символ.
+// Возвращает io.EOF после символа EOF, а также если поток пуст.
+func (r *Reader) ReadSymbol() (int, error) {
+	if r.eof {
+		return 0, io.EOF
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.dec == nil {
+		dec, err := newDecoder(r.in)
+		if err == io.EOF {
+			r.eof = true
+			return 0, io.EOF
+		}
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.dec = dec
+	}
+	s, err := r.model.decode(r.dec)
+	if err == nil {
+		err = r.dec.err
+	}
+	if err != nil {
+		r.err = err
+		return 0, err
+	}
+	if s == r.alphabetSize {
+		r.eof = true
+		return 0, io.EOF
+	}
+	return s, nil
+}
@@ -0,0 +1,85 @@
+package arith
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Writer - это реализация модуля записи арифметического кода.
+// Должен быть закрыт для правильной отправки EOF.
+type Writer struct {
+	out          *bufio.Writer
+	enc          *encoder
+	model        model
+	alphabetSize int
+	started      bool  // Сообщает, был ли записан хотя бы один символ
+	err          error // Ошибка в параметрах, возвращается всеми вызовами
+}
+
+// NewWriter возвращает новый Writer, используя указанный io.Writer в качестве вывода,
+// с параметрами по умолчанию.
+func NewWriter(out io.Writer) *Writer {
+	return NewWriterOptions(out, nil)
+}
+
+// NewWriterOptions возвращает новый Writer с указанными параметрами.
+// Reader правильно декодирует поток, только если он создан с теми же параметрами.
+// Ошибка в параметрах будет возвращена первым вызовом Write, WriteSymbol или Close.
+func NewWriterOptions(out io.Writer, o *Options) *Writer {
+	o = checkOptions(o)
+	w := &Writer{out: bufio.NewWriter(out), alphabetSize: o.AlphabetSize}
+	if w.err = o.validate(); w.err != nil {
+		return w
+	}
+	w.enc = newEncoder(w.out)
+	w.model = newModel(o.Model, o.AlphabetSize+1)
+	return w
+}
+
+// Write записывает сжатую форму p в базовый io.Writer.
+// Сжатые данные не обязательно сбрасываются до закрытия Writer.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	for i, b := range p {
+		if err = w.WriteByte(b); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+// WriteByte записывает сжатую форму b в базовый io.Writer.
+func (w *Writer) WriteByte(b byte) error {
+	return w.WriteSymbol(int(b))
+}
+
+// WriteSymbol записывает сжатую форму символа s, лежащего в пределах [0, Options.AlphabetSize).
+// Сжатый символ не обязательно сбрасывается до закрытия Writer.
+func (w *Writer) WriteSymbol(s int) error {
+	if w.err != nil {
+		return w.err
+	}
+	if s < 0 || s >= w.alphabetSize {
+		return fmt.Errorf("arith: symbol %d is outside the alphabet of %d symbols", s, w.alphabetSize)
+	}
+	w.started = true
+	w.model.encode(w.enc, s)
+	return w.enc.err
+}
+
+// Close записывает символ EOF и сбрасывает сжатые данные в базовый io.Writer.
+// Базовый io.Writer не закрывается. Если не было записано ни одного символа,
+// ничего не записывается.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.started {
+		w.model.encode(w.enc, w.alphabetSize)
+		if err := w.enc.flush(); err != nil {
+			return err
+		}
+		w.started = false
+	}
+	return w.out.Flush()
+}
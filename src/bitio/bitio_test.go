@@ -0,0 +1,394 @@
+package bitio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+// testBytes возвращает n псевдослучайных байтов.
+func testBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+// bitsAt возвращает n битов data, начиная с бита off; биты за концом data равны 0.
+func bitsAt(data []byte, off, n int) (u uint64) {
+	for i := off; i < off+n; i++ {
+		u <<= 1
+		if i/8 < len(data) {
+			u |= uint64(data[i/8]>>(7-uint(i%8))) & 1
+		}
+	}
+	return u
+}
+
+// testSources - источники, отдающие данные целиком и по одному байту:
+// во втором случае кеш Reader дочитывается побайтно.
+var testSources = []struct {
+	name string
+	new  func([]byte) io.Reader
+}{
+	{"whole", func(b []byte) io.Reader { return bytes.NewReader(b) }},
+	{"one byte", func(b []byte) io.Reader { return iotest.OneByteReader(bytes.NewReader(b)) }},
+}
+
+func TestPeekSkip(t *testing.T) {
+	data := testBytes(40)
+	for _, src := range testSources {
+		// Смещения пересекают границы 64-битного кеша
+		for off := 0; off <= 130; off++ {
+			for _, n := range []uint8{1, 7, 8, 25, 56, MaxPeekBits} {
+				r := NewReader(src.new(data))
+				if err := r.SkipBits(uint8(off)); err != nil {
+					t.Fatalf("%s: skip %d: %v", src.name, off, err)
+				}
+				// Повторный просмотр возвращает те же биты: PeekBits их не потребляет
+				for i := 0; i < 2; i++ {
+					if u, err := r.PeekBits(n); err != nil || u != bitsAt(data, off, int(n)) {
+						t.Fatalf("%s: peek %d bits at %d: got %#x, %v; want %#x", src.name, n, off, u, err, bitsAt(data, off, int(n)))
+					}
+				}
+				if err := r.SkipBits(n); err != nil {
+					t.Fatalf("%s: skip %d bits at %d: %v", src.name, n, off, err)
+				}
+				if u, err := r.ReadBits(9); err != nil || u != bitsAt(data, off+int(n), 9) {
+					t.Fatalf("%s: read 9 bits at %d: got %#x, %v", src.name, off+int(n), u, err)
+				}
+			}
+		}
+		// SkipBits больше MaxPeekBits пропускает биты в несколько приемов
+		r := NewReader(src.new(data))
+		if err := r.SkipBits(255); err != nil {
+			t.Fatalf("%s: skip 255: %v", src.name, err)
+		}
+		if u, err := r.ReadBits(8); err != nil || u != bitsAt(data, 255, 8) {
+			t.Fatalf("%s: read 8 bits at 255: got %#x, %v", src.name, u, err)
+		}
+	}
+}
+
+func TestPeekSkipEOF(t *testing.T) {
+	data := testBytes(3)
+	for _, src := range testSources {
+		r := NewReader(src.new(data))
+		if err := r.SkipBits(10); err != nil {
+			t.Fatal(err)
+		}
+		// Осталось 14 битов: недостающие младшие биты просмотра равны 0
+		if u, err := r.PeekBits(20); err != ErrTruncated || u != bitsAt(data, 10, 20) {
+			t.Errorf("%s: peek 20 of 14 bits: got %#x, %v; want %#x, ErrTruncated", src.name, u, err, bitsAt(data, 10, 20))
+		}
+		if u, err := r.PeekBits(14); err != nil || u != bitsAt(data, 10, 14) {
+			t.Errorf("%s: peek the last 14 bits: got %#x, %v", src.name, u, err)
+		}
+		if err := r.SkipBits(20); err != ErrTruncated {
+			t.Errorf("%s: skip 20 of 14 bits: got %v, want ErrTruncated", src.name, err)
+		}
+		if _, err := r.PeekBits(1); err != io.EOF {
+			t.Errorf("%s: peek at EOF: got %v, want io.EOF", src.name, err)
+		}
+		if err := r.SkipBits(1); err != io.EOF {
+			t.Errorf("%s: skip at EOF: got %v, want io.EOF", src.name, err)
+		}
+		if _, err := r.ReadBits(1); err != io.EOF {
+			t.Errorf("%s: read at EOF: got %v, want io.EOF", src.name, err)
+		}
+	}
+	// Просмотр ровно до конца потока - не ошибка
+	r := NewReader(bytes.NewReader(data))
+	if u, err := r.PeekBits(24); err != nil || u != bitsAt(data, 0, 24) {
+		t.Errorf("peek all 24 bits: got %#x, %v", u, err)
+	}
+	if _, err := r.PeekBits(MaxPeekBits + 1); err == nil {
+		t.Errorf("peek of %d bits succeeded", MaxPeekBits+1)
+	}
+}
+
+// testValue - значение битового потока и его положение.
+type testValue struct {
+	pos   int64 // Номер первого бита
+	u     uint64
+	width uint8
+}
+
+// testStream записывает n значений разной длины, перемежая их выравниванием и байтами.
+func testStream(t *testing.T, n int) ([]byte, []testValue) {
+	rng := rand.New(rand.NewSource(2))
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	values := make([]testValue, n)
+	for i := range values {
+		if i%100 == 99 {
+			w.Align()
+			w.Write([]byte{1, 2, 3})
+		}
+		width := uint8(1 + rng.Intn(64))
+		values[i] = testValue{pos: w.BitsWritten(), u: rng.Uint64() >> (64 - width), width: width}
+		if err := w.WriteBits(values[i].u, width); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), values
+}
+
+func TestBitsRead(t *testing.T) {
+	data, values := testStream(t, 5000)
+	for _, src := range testSources {
+		r := NewReader(src.new(data))
+		for i, v := range values {
+			if i%100 == 99 {
+				r.Align()
+				if _, err := io.ReadFull(r, make([]byte, 3)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := r.BitsRead(); got != v.pos {
+				t.Fatalf("%s: value %d: BitsRead = %d, want %d", src.name, i, got, v.pos)
+			}
+			if u, err := r.ReadBits(v.width); err != nil || u != v.u {
+				t.Fatalf("%s: value %d: got %#x, %v; want %#x", src.name, i, u, err, v.u)
+			}
+		}
+		if got, want := r.BitsRead(), values[len(values)-1].pos+int64(values[len(values)-1].width); got != want {
+			t.Fatalf("%s: BitsRead at the end = %d, want %d", src.name, got, want)
+		}
+	}
+}
+
+func TestSeekBit(t *testing.T) {
+	data, values := testStream(t, 5000)
+	// Reader отсчитывает биты от позиции источника при создании
+	prefix := []byte("junk")
+	src := bytes.NewReader(append(prefix, data...))
+	src.Seek(int64(len(prefix)), io.SeekStart)
+	r := NewReader(src)
+	// Частичное чтение перед переходом: часть кеша и буфера отбрасывается
+	if _, err := r.ReadBits(13); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range rand.New(rand.NewSource(3)).Perm(len(values)) {
+		v := values[i]
+		if err := r.SeekBit(v.pos); err != nil {
+			t.Fatalf("seek to value %d at %d: %v", i, v.pos, err)
+		}
+		if got := r.BitsRead(); got != v.pos {
+			t.Fatalf("value %d: BitsRead after SeekBit = %d, want %d", i, got, v.pos)
+		}
+		if u, err := r.ReadBits(v.width); err != nil || u != v.u {
+			t.Fatalf("value %d at %d: got %#x, %v; want %#x", i, v.pos, u, err, v.u)
+		}
+		if got := r.BitsRead(); got != v.pos+int64(v.width) {
+			t.Fatalf("value %d: BitsRead after reading = %d, want %d", i, got, v.pos+int64(v.width))
+		}
+	}
+	if err := r.SeekBit(-1); err == nil {
+		t.Error("SeekBit(-1) succeeded")
+	}
+	// Переход за конец потока: чтение возвращает io.EOF
+	if err := r.SeekBit(8 * int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadBits(1); err != io.EOF {
+		t.Errorf("read after seeking to the end: got %v, want io.EOF", err)
+	}
+	if err := NewReader(iotest.OneByteReader(bytes.NewReader(data))).SeekBit(0); err != ErrNotSeeker {
+		t.Errorf("SeekBit without io.Seeker: got %v, want ErrNotSeeker", err)
+	}
+}
+
+// edgeValues возвращает 0, 1, максимальное значение и значения вокруг всех степеней двойки.
+func edgeValues() []uint64 {
+	values := []uint64{0, 1, ^uint64(0)}
+	for k := uint(1); k < 64; k++ {
+		values = append(values, 1<<k-1, 1<<k, 1<<k+1)
+	}
+	return values
+}
+
+// intCode - универсальный код целых чисел с параметром.
+type intCode struct {
+	name  string
+	write func(w *Writer, x uint64) error
+	read  func(r *Reader) (uint64, error)
+	valid func(x uint64) bool // Можно ли записать x этим кодом
+}
+
+// intCodes возвращает коды Writer с наборами параметров, включая крайние.
+func intCodes() []intCode {
+	codes := []intCode{
+		{"gamma", (*Writer).WriteGamma, (*Reader).ReadGamma, func(x uint64) bool { return x > 0 }},
+		{"delta", (*Writer).WriteDelta, (*Reader).ReadDelta, func(x uint64) bool { return x > 0 }},
+		{"uvarint", (*Writer).WriteUvarint, (*Reader).ReadUvarint, func(x uint64) bool { return true }},
+	}
+	for _, k := range []uint8{0, 1, 5, 32, 63} {
+		k := k
+		codes = append(codes, intCode{fmt.Sprintf("exp-golomb %d", k),
+			func(w *Writer, x uint64) error { return w.WriteExpGolomb(x, k) },
+			func(r *Reader) (uint64, error) { return r.ReadExpGolomb(k) },
+			func(x uint64) bool { return x <= ^uint64(0)-1<<k },
+		})
+	}
+	for _, k := range []uint8{0, 1, 8, 63, 64} {
+		k := k
+		codes = append(codes, intCode{fmt.Sprintf("rice %d", k),
+			func(w *Writer, x uint64) error { return w.WriteRice(x, k) },
+			func(r *Reader) (uint64, error) { return r.ReadRice(k) },
+			func(x uint64) bool { return k == 64 || x>>k <= MaxRiceQuotient },
+		})
+	}
+	return codes
+}
+
+func TestIntCodes(t *testing.T) {
+	for _, c := range intCodes() {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		var written []uint64
+		for _, x := range edgeValues() {
+			err := c.write(w, x)
+			if !c.valid(x) {
+				if !errors.Is(err, ErrOutOfRange) {
+					t.Errorf("%s: writing %d: got %v, want ErrOutOfRange", c.name, x, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: writing %d: %v", c.name, x, err)
+			}
+			// Маркер после каждого кода проверяет его длину
+			w.WriteBits(5, 3)
+			written = append(written, x)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r := NewReader(&buf)
+		for _, x := range written {
+			if got, err := c.read(r); err != nil || got != x {
+				t.Fatalf("%s: got %d, %v; want %d", c.name, got, err, x)
+			}
+			if m, err := r.ReadBits(3); err != nil || m != 5 {
+				t.Fatalf("%s: marker after %d is %d, %v", c.name, x, m, err)
+			}
+		}
+		// После кодов остались только биты выравнивания Close
+		r.Align()
+		if _, err := c.read(r); err != io.EOF {
+			t.Errorf("%s: got %v at the end, want io.EOF", c.name, err)
+		}
+	}
+}
+
+func TestIntCodesInvalid(t *testing.T) {
+	// bitStream возвращает поток из n битов bit и завершающего байта 0xff.
+	bitStream := func(bit bool, n int) *Reader {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		for i := 0; i < n; i++ {
+			w.WriteBool(bit)
+		}
+		w.WriteBits(0xff, 8)
+		w.Close()
+		return NewReader(&buf)
+	}
+	for _, tt := range []struct {
+		name string
+		r    *Reader
+		read func(r *Reader) (uint64, error)
+	}{
+		{"gamma of 64 zeros", bitStream(false, 64), (*Reader).ReadGamma},
+		{"delta of 65 bits", bitStream(false, 6), (*Reader).ReadDelta},
+		{"exp-golomb of 64 bits", bitStream(false, 63), func(r *Reader) (uint64, error) { return r.ReadExpGolomb(1) }},
+		{"rice quotient too long", bitStream(true, MaxRiceQuotient+1), func(r *Reader) (uint64, error) { return r.ReadRice(0) }},
+	} {
+		if x, err := tt.read(tt.r); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("%s: got %d, %v; want ErrInvalidCode", tt.name, x, err)
+		}
+	}
+	// Поток, оборванный посреди кода
+	for _, c := range intCodes() {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if err := c.write(w, 1000); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		stream := buf.Bytes()
+		if _, err := c.read(NewReader(bytes.NewReader(stream[:len(stream)-1]))); !errors.Is(err, ErrTruncated) {
+			t.Errorf("%s: truncated code: got %v, want ErrTruncated", c.name, err)
+		}
+	}
+}
+
+// benchmarkBits - количество битов, которое записывается и читается за одну итерацию.
+const benchmarkBits = 1 << 23
+
+// benchmarkWidths - длины записываемых значений, типичные для кодов Хаффмана.
+var benchmarkWidths = [...]uint8{3, 7, 1, 12, 5, 9, 2, 17}
+
+// benchmarkStream возвращает битовый поток значений длин benchmarkWidths и количество значений в нем.
+func benchmarkStream(tb testing.TB) ([]byte, int) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	bits, n := 0, 0
+	for ; bits < benchmarkBits; n++ {
+		k := benchmarkWidths[n%len(benchmarkWidths)]
+		w.TryWriteBits(uint64(n), k)
+		bits += int(k)
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes(), n
+}
+
+func BenchmarkWriteBits(b *testing.B) {
+	_, n := benchmarkStream(b)
+	b.SetBytes(benchmarkBits / 8)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := NewWriter(ioutil.Discard)
+		for j := 0; j < n; j++ {
+			w.WriteBits(uint64(j), benchmarkWidths[j%len(benchmarkWidths)])
+		}
+		w.Close()
+	}
+}
+
+func BenchmarkReadBits(b *testing.B) {
+	data, n := benchmarkStream(b)
+	b.SetBytes(benchmarkBits / 8)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := NewReader(bytes.NewReader(data))
+		for j := 0; j < n; j++ {
+			if _, err := r.ReadBits(benchmarkWidths[j%len(benchmarkWidths)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkReadBool(b *testing.B) {
+	data, _ := benchmarkStream(b)
+	b.SetBytes(benchmarkBits / 8)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := NewReader(bytes.NewReader(data))
+		for j := 0; j < benchmarkBits; j++ {
+			if _, err := r.ReadBool(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package bitio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+var (
+	// ErrOutOfRange возвращается методами WriteXXX, если значение нельзя записать выбранным кодом.
+	ErrOutOfRange = errors.New("bitio: value out of range")
+	// ErrInvalidCode возвращается методами ReadXXX, если прочитанный код не мог быть записан Writer.
+	ErrInvalidCode = errors.New("bitio: invalid integer code")
+)
+
+// MaxRiceQuotient - наибольшее частное x >> k кода Райса. Унарная часть кода
+// длиннее MaxRiceQuotient битов означает неверно выбранный параметр k, а при чтении -
+// поврежденные данные.
+const MaxRiceQuotient = 1 << 16
+
+// WriteGamma записывает x >= 1 гамма-кодом Элиаса: N нулей и N+1 битов x, где N = ⌊log2 x⌋.
+func (w *Writer) WriteGamma(x uint64) error {
+	if x == 0 {
+		return fmt.Errorf("%w: gamma code of 0", ErrOutOfRange)
+	}
+	n := uint8(bits.Len64(x))
+	if err := w.WriteBitsUnsafe(0, n-1); err != nil {
+		return err
+	}
+	return w.WriteBitsUnsafe(x, n)
+}
+
+// WriteDelta записывает x >= 1 дельта-кодом Элиаса: количество битов x гамма-кодом
+// и биты x без старшей единицы.
+func (w *Writer) WriteDelta(x uint64) error {
+	if x == 0 {
+		return fmt.Errorf("%w: delta code of 0", ErrOutOfRange)
+	}
+	n := uint8(bits.Len64(x))
+	if err := w.WriteGamma(uint64(n)); err != nil {
+		return err
+	}
+	return w.WriteBits(x, n-1)
+}
+
+// WriteExpGolomb записывает x экспоненциальным кодом Голомба порядка k (k <= 63):
+// гамма-код x + 2^k без k начальных нулей. x + 2^k должно помещаться в 64 бита.
+func (w *Writer) WriteExpGolomb(x uint64, k uint8) error {
+	if k > 63 {
+		return fmt.Errorf("%w: Exp-Golomb order %d", ErrOutOfRange, k)
+	}
+	v := x + 1<<k
+	if v < x {
+		return fmt.Errorf("%w: Exp-Golomb code of %d with order %d", ErrOutOfRange, x, k)
+	}
+	n := uint8(bits.Len64(v))
+	if err := w.WriteBitsUnsafe(0, n-1-k); err != nil {
+		return err
+	}
+	return w.WriteBitsUnsafe(v, n)
+}
+
+// WriteRice записывает x кодом Райса с параметром k (k <= 64): частное x >> k в унарном коде
+// (единицы и завершающий 0) и k младших битов x.
+// Длина кода растет линейно с x >> k, поэтому k нужно подбирать по порядку значений;
+// частное больше MaxRiceQuotient возвращает ErrOutOfRange.
+func (w *Writer) WriteRice(x uint64, k uint8) error {
+	if k > 64 {
+		return fmt.Errorf("%w: Rice parameter %d", ErrOutOfRange, k)
+	}
+	var q uint64
+	if k < 64 {
+		q = x >> k
+	}
+	if q > MaxRiceQuotient {
+		return fmt.Errorf("%w: Rice code of %d with parameter %d has quotient above %d", ErrOutOfRange, x, k, MaxRiceQuotient)
+	}
+	for ; q >= 32; q -= 32 {
+		if err := w.WriteBitsUnsafe(1<<32-1, 32); err != nil {
+			return err
+		}
+	}
+	if err := w.WriteBitsUnsafe((1<<q-1)<<1, uint8(q)+1); err != nil {
+		return err
+	}
+	return w.WriteBits(x, k)
+}
+
+// WriteUvarint записывает x в формате binary.PutUvarint (7 битов в байте).
+// Предназначен для заголовков, поэтому обычно вызывается после Align.
+func (w *Writer) WriteUvarint(x uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	_, err := w.Write(buf[:n])
+	return err
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает WriteGamma (),
+// и сохраняет ошибку в поле TryError.
+func (w *Writer) TryWriteGamma(x uint64) {
+	if w.TryError == nil {
+		w.TryError = w.WriteGamma(x)
+	}
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает WriteDelta (),
+// и сохраняет ошибку в поле TryError.
+func (w *Writer) TryWriteDelta(x uint64) {
+	if w.TryError == nil {
+		w.TryError = w.WriteDelta(x)
+	}
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает WriteExpGolomb (),
+// и сохраняет ошибку в поле TryError.
+func (w *Writer) TryWriteExpGolomb(x uint64, k uint8) {
+	if w.TryError == nil {
+		w.TryError = w.WriteExpGolomb(x, k)
+	}
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает WriteRice (),
+// и сохраняет ошибку в поле TryError.
+func (w *Writer) TryWriteRice(x uint64, k uint8) {
+	if w.TryError == nil {
+		w.TryError = w.WriteRice(x, k)
+	}
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает WriteUvarint (),
+// и сохраняет ошибку в поле TryError.
+func (w *Writer) TryWriteUvarint(x uint64) {
+	if w.TryError == nil {
+		w.TryError = w.WriteUvarint(x)
+	}
+}
+
+// readRun читает серию битов, равных bit, и завершающий ее противоположный бит.
+// Возвращает длину серии; серия длиннее limit считается ErrInvalidCode.
+func (r *Reader) readRun(bit bool, limit uint64) (n uint64, err error) {
+	for {
+		b, err := r.ReadBool()
+		if err != nil {
+			return 0, truncated(err, n > 0)
+		}
+		if b != bit {
+			return n, nil
+		}
+		if n++; n > limit {
+			return 0, fmt.Errorf("%w: run of %d bits is too long", ErrInvalidCode, n)
+		}
+	}
+}
+
+// ReadGamma читает значение, записанное WriteGamma.
+// Как и ReadBits, возвращает io.EOF, если поток закончился до первого бита кода,
+// и ErrTruncated, если он закончился посреди кода.
+func (r *Reader) ReadGamma() (uint64, error) {
+	return r.readExpGolomb(0)
+}
+
+// ReadDelta читает значение, записанное WriteDelta.
+func (r *Reader) ReadDelta() (uint64, error) {
+	n, err := r.ReadGamma()
+	if err != nil {
+		return 0, err
+	}
+	if n > 64 {
+		return 0, fmt.Errorf("%w: delta code of %d bits", ErrInvalidCode, n)
+	}
+	u, err := r.ReadBits(uint8(n - 1))
+	if err != nil {
+		return 0, truncated(err, true)
+	}
+	return 1<<(n-1) | u, nil
+}
+
+// ReadExpGolomb читает значение, записанное WriteExpGolomb с тем же k.
+func (r *Reader) ReadExpGolomb(k uint8) (uint64, error) {
+	if k > 63 {
+		return 0, fmt.Errorf("%w: Exp-Golomb order %d", ErrOutOfRange, k)
+	}
+	v, err := r.readExpGolomb(k)
+	if err != nil {
+		return 0, err
+	}
+	return v - 1<<k, nil
+}
+
+// readExpGolomb читает экспоненциальный код Голомба порядка k и возвращает x + 2^k.
+func (r *Reader) readExpGolomb(k uint8) (uint64, error) {
+	z, err := r.readRun(false, uint64(63-k))
+	if err != nil {
+		return 0, err
+	}
+	n := uint8(z) + k
+	u, err := r.ReadBits(n)
+	if err != nil {
+		return 0, truncated(err, true)
+	}
+	return 1<<n | u, nil
+}
+
+// ReadRice читает значение, записанное WriteRice с тем же k.
+func (r *Reader) ReadRice(k uint8) (uint64, error) {
+	if k > 64 {
+		return 0, fmt.Errorf("%w: Rice parameter %d", ErrOutOfRange, k)
+	}
+	limit := uint64(0)
+	if k < 64 {
+		limit = ^uint64(0) >> k
+	}
+	if limit > MaxRiceQuotient {
+		limit = MaxRiceQuotient
+	}
+	q, err := r.readRun(true, limit)
+	if err != nil {
+		return 0, err
+	}
+	u, err := r.ReadBits(k)
+	if err != nil {
+		return 0, truncated(err, true)
+	}
+	if k == 64 {
+		return u, nil
+	}
+	return q<<k | u, nil
+}
+
+// ReadUvarint читает значение, записанное WriteUvarint.
+func (r *Reader) ReadUvarint() (uint64, error) {
+	x, err := binary.ReadUvarint(r)
+	if err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return x, err
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает ReadGamma (),
+// возвращает предоставленные данные и сохраняет ошибку в поле TryError.
+func (r *Reader) TryReadGamma() (x uint64) {
+	if r.TryError == nil {
+		x, r.TryError = r.ReadGamma()
+	}
+	return
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает ReadDelta (),
+// возвращает предоставленные данные и сохраняет ошибку в поле TryError.
+func (r *Reader) TryReadDelta() (x uint64) {
+	if r.TryError == nil {
+		x, r.TryError = r.ReadDelta()
+	}
+	return
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает ReadExpGolomb (),
+// возвращает предоставленные данные и сохраняет ошибку в поле TryError.
+func (r *Reader) TryReadExpGolomb(k uint8) (x uint64) {
+	if r.TryError == nil {
+		x, r.TryError = r.ReadExpGolomb(k)
+	}
+	return
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает ReadRice (),
+// возвращает предоставленные данные и сохраняет ошибку в поле TryError.
+func (r *Reader) TryReadRice(k uint8) (x uint64) {
+	if r.TryError == nil {
+		x, r.TryError = r.ReadRice(k)
+	}
+	return
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает ReadUvarint (),
+// возвращает предоставленные данные и сохраняет ошибку в поле TryError.
+func (r *Reader) TryReadUvarint() (x uint64) {
+	if r.TryError == nil {
+		x, r.TryError = r.ReadUvarint()
+	}
+	return
+}
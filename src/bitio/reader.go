@@ -1,142 +1,290 @@
 package bitio
 
 import (
-	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 )
 
-type readerAndByteReader interface {
-	io.Reader
-	io.ByteReader
-}
+// ErrTruncated возвращается, если поток закончился посреди считываемого значения,
+// то есть часть его битов уже была прочитана.
+var ErrTruncated = errors.New("bitio: truncated bit stream")
+
+// ErrNotSeeker возвращается SeekBit, если источник не реализует io.Seeker.
+var ErrNotSeeker = errors.New("bitio: source does not implement io.Seeker")
+
+// MaxPeekBits - наибольшее количество битов, которое можно просмотреть PeekBits.
+const MaxPeekBits = 57
 
+// errPeekTooLong возвращается PeekBits, если запрошено больше MaxPeekBits битов.
+var errPeekTooLong = errors.New("bitio: cannot peek more than 57 bits")
+
+// maxEmptyReads - количество подряд идущих чтений источника без данных и без ошибки,
+// после которого Reader возвращает io.ErrNoProgress.
+const maxEmptyReads = 100
+
+// Reader читает битовый поток. Он читает источник блоками по bufferSize байтов
+// и переносит их в 64-битный кеш целыми словами, поэтому позиция в источнике
+// может опережать позицию в битовом потоке.
 type Reader struct {
-	in    readerAndByteReader
-	cache byte // здесь хранятся непрочитанные биты
-	bits  byte // количество непрочитанных битов в кеше
+	in     io.Reader
+	buf    []byte // байты, прочитанные из источника и еще не перенесенные в кеш
+	pos    int    // позиция первого непрочитанного байта buf
+	offset int64  // количество байтов, прочитанных из источника с момента создания или SeekBit
+	base   int64  // номер байта источника, с которого отсчитывается offset
+	cache  uint64 // здесь хранятся непрочитанные биты: младшие bits битов, первым идет старший из них
+	bits   uint8  // количество непрочитанных битов в кеше
+	err    error  // ошибка чтения источника; биты, прочитанные до нее, еще можно получить
 	// TryError содержит первую ошибку, возникшую в методах TryXXX ().
 	TryError error
 }
 
 // NewReader возвращает новый Reader, используя указанный io.Reader в качестве входа (источника).
 func NewReader(in io.Reader) *Reader {
-	bin, ok := in.(readerAndByteReader)
-	if !ok {
-		bin = bufio.NewReader(in)
+	return &Reader{in: in, buf: make([]byte, 0, bufferSize)}
+}
+
+// fill дочитывает кеш, пока в нем есть место хотя бы для одного байта.
+// Источник читается, только если в кеше меньше n битов, поэтому Reader не ждет данных,
+// которые еще не нужны (например, из сети). После fill в кеше не меньше n битов,
+// если источник не закончился.
+func (r *Reader) fill(n uint8) {
+	if len(r.buf)-r.pos >= 8 {
+		// частый случай: в буфере есть целое слово
+		word := binary.BigEndian.Uint64(r.buf[r.pos:])
+		k := (64 - r.bits) / 8 // количество байтов, которые поместятся в кеш
+		r.cache = r.cache<<(8*k) | word>>(64-8*k)
+		r.bits += 8 * k
+		r.pos += int(k)
+		return
+	}
+	for r.bits <= 64-8 {
+		if r.pos == len(r.buf) && (r.bits >= n || !r.readBuffer()) {
+			return
+		}
+		r.cache = r.cache<<8 | uint64(r.buf[r.pos])
+		r.bits += 8
+		r.pos++
+	}
+}
+
+// readBuffer заново заполняет пустой буфер из источника.
+// Возвращает false, если источник больше не дает данных, ошибка сохраняется в r.err.
+func (r *Reader) readBuffer() bool {
+	if r.err != nil {
+		return false
+	}
+	for i := 0; i < maxEmptyReads; i++ {
+		n, err := r.in.Read(r.buf[:cap(r.buf)])
+		r.buf, r.pos = r.buf[:n], 0
+		r.offset += int64(n)
+		if err != nil {
+			r.err = err
+		}
+		if n > 0 {
+			return true
+		}
+		if err != nil {
+			return false
+		}
 	}
-	return &Reader{in: bin}
+	r.err = io.ErrNoProgress
+	return false
+}
+
+// need проверяет, что в кеше есть хотя бы n (n <= MaxPeekBits) битов, при необходимости дочитывая его.
+func (r *Reader) need(n uint8) error {
+	if r.bits >= n {
+		return nil
+	}
+	r.fill(n)
+	if r.bits >= n {
+		return nil
+	}
+	return truncated(r.err, r.bits > 0)
 }
 
 // Read реализует io.Reader и дает представление битового потока на уровне байтов.
-// Это даст лучшую производительность, если базовый io.Reader выровнен
+// Это даст лучшую производительность, если битовый поток выровнен
 // до границы байта (иначе все отдельные байты собираются из нескольких байтов).
 // Границу байта можно обеспечить, вызвав Align ().
 func (r *Reader) Read(p []byte) (n int, err error) {
-	// r.bits будет таким же после чтения 8 бит, поэтому нам не нужно это обновлять.
-	if r.bits == 0 {
-		return r.in.Read(p)
+	if r.bits%8 != 0 {
+		for ; n < len(p); n++ {
+			if p[n], err = r.ReadByte(); err != nil {
+				return
+			}
+		}
+		return
 	}
-	for ; n < len(p); n++ {
-		if p[n], err = r.readUnalignedByte(); err != nil {
-			return
+	// Сначала отдаем байты, прочитанные с опережением: из кеша и из буфера
+	for ; n < len(p) && r.bits > 0; n++ {
+		r.bits -= 8
+		p[n] = byte(r.cache >> r.bits)
+	}
+	m := copy(p[n:], r.buf[r.pos:])
+	r.pos += m
+	n += m
+	if n == len(p) {
+		return
+	}
+	if r.err != nil {
+		if n > 0 {
+			return n, nil
 		}
+		return 0, r.err
 	}
-	return
+	m, err = r.in.Read(p[n:])
+	r.offset += int64(m)
+	if err != nil {
+		r.err = err
+	}
+	return n + m, err
+}
+
+// BitsRead возвращает номер следующего бита потока: количество битов, прочитанных
+// с момента создания Reader (включая биты, пропущенные Align и SkipBits), или позицию,
+// установленную SeekBit.
+func (r *Reader) BitsRead() int64 {
+	return 8*(r.base+r.offset-int64(len(r.buf)-r.pos)) - int64(r.bits)
+}
+
+// SeekBit переходит к биту с номером offset; номера битов отсчитываются так же, как в BitsRead.
+// Источник должен реализовывать io.Seeker.
+func (r *Reader) SeekBit(offset int64) error {
+	seeker, ok := r.in.(io.Seeker)
+	if !ok {
+		return ErrNotSeeker
+	}
+	if offset < 0 {
+		return fmt.Errorf("bitio: negative bit offset %d", offset)
+	}
+	// Номер байта источника, соответствующий началу отсчета
+	cur, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	start := cur - r.offset - r.base
+	if _, err = seeker.Seek(start+offset/8, io.SeekStart); err != nil {
+		return err
+	}
+	r.buf, r.pos, r.offset, r.base = r.buf[:0], 0, 0, offset/8
+	r.cache, r.bits, r.err = 0, 0, nil
+	return r.SkipBits(uint8(offset % 8))
 }
 
 // ReadBits считывает n битов и возвращает их как младшие n битов u.
+// Возвращает io.EOF, если поток закончился до первого бита значения,
+// и ErrTruncated, если он закончился посреди значения.
 func (r *Reader) ReadBits(n uint8) (u uint64, err error) {
-	// Some optimization, frequent cases
-	if n < r.bits {
-		// в кеше есть все необходимые биты, и есть некоторые лишние, которые останутся в кеше
-		shift := r.bits - n
-		u = uint64(r.cache >> shift)
-		r.cache &= 1<<shift - 1
-		r.bits = shift
-		return
+	if n <= r.bits {
+		// частый случай: все биты уже в кеше
+		r.bits -= n
+		return r.cache >> r.bits & (1<<n - 1), nil
 	}
-
-	if n > r.bits {
-		// нужны все биты кеша, и этого недостаточно, поэтому будет прочитано больше
-		if r.bits > 0 {
-			u = uint64(r.cache)
-			n -= r.bits
+	if n > MaxPeekBits {
+		// читаем значение в два приема
+		hi, err := r.ReadBits(n - 32)
+		if err != nil {
+			return 0, err
 		}
-		// Читаем целые байты
-		for n >= 8 {
-			b, err2 := r.in.ReadByte()
-			if err2 != nil {
-				return 0, err2
-			}
-			u = u<<8 + uint64(b)
-			n -= 8
+		lo, err := r.ReadBits(32)
+		if err != nil {
+			return 0, truncated(err, true)
 		}
-		// Считываем последнюю фракицю, если есть
-		if n > 0 {
-			if r.cache, err = r.in.ReadByte(); err != nil {
-				return 0, err
+		return hi<<32 | lo, nil
+	}
+	if err = r.need(n); err != nil {
+		return 0, err
+	}
+	r.bits -= n
+	return r.cache >> r.bits & (1<<n - 1), nil
+}
+
+// PeekBits возвращает следующие n битов (n <= MaxPeekBits) как младшие n битов u, не потребляя их.
+// Если поток заканчивается раньше, недостающие младшие биты u равны 0, а err равна
+// io.EOF (если битов не осталось) или ErrTruncated. Табличные декодеры могут игнорировать
+// эту ошибку: SkipBits вернет ее, если код действительно не поместился в поток.
+func (r *Reader) PeekBits(n uint8) (u uint64, err error) {
+	if n <= r.bits {
+		return r.cache >> (r.bits - n) & (1<<n - 1), nil
+	}
+	return r.peekSlow(n)
+}
+
+// peekSlow дочитывает кеш для PeekBits.
+func (r *Reader) peekSlow(n uint8) (u uint64, err error) {
+	if n > MaxPeekBits {
+		return 0, errPeekTooLong
+	}
+	if err = r.need(n); err != nil {
+		return r.cache << (n - r.bits) & (1<<n - 1), err
+	}
+	return r.cache >> (r.bits - n) & (1<<n - 1), nil
+}
+
+// SkipBits пропускает n битов. Если поток заканчивается раньше, пропускает все оставшиеся биты
+// и возвращает io.EOF (если битов не было) или ErrTruncated.
+func (r *Reader) SkipBits(n uint8) error {
+	if n <= r.bits {
+		r.bits -= n
+		return nil
+	}
+	return r.skipSlow(n)
+}
+
+// skipSlow пропускает биты для SkipBits, дочитывая кеш.
+func (r *Reader) skipSlow(n uint8) error {
+	partial := false // Сообщает, пропущена ли уже часть битов
+	for n > 0 {
+		k := n
+		if k > MaxPeekBits {
+			k = MaxPeekBits
+		}
+		if err := r.need(k); err != nil {
+			if r.bits > 0 || partial {
+				err = truncated(r.err, true)
 			}
-			shift := 8 - n
-			u = u<<n + uint64(r.cache>>shift)
-			r.cache &= 1<<shift - 1
-			r.bits = shift
-		} else {
 			r.bits = 0
+			return err
 		}
-		return u, nil
+		r.bits -= k
+		n -= k
+		partial = true
 	}
-
-	// в кеше ровно столько, сколько нужно
-	r.bits = 0 // не нужно очищать кеш, будет перезаписано при следующем чтении
-	return uint64(r.cache), nil
+	return nil
 }
 
 // ReadByte реализует io.ByteReader.
 func (r *Reader) ReadByte() (b byte, err error) {
-	// r.bits будет таким же после чтения 8 бит, поэтому нам не нужно это обновлять.
-	if r.bits == 0 {
-		return r.in.ReadByte()
-	}
-	return r.readUnalignedByte()
+	u, err := r.ReadBits(8)
+	return byte(u), err
 }
 
-// readUnalignedByte считывает следующие 8 бит, которые (могут быть) невыровненными, и возвращает их как байт.
-func (r *Reader) readUnalignedByte() (b byte, err error) {
-	// r.bits будет таким же после чтения 8 бит, поэтому нам не нужно это обновлять.
-	bits := r.bits
-	b = r.cache << (8 - bits)
-	r.cache, err = r.in.ReadByte()
-	if err != nil {
-		return 0, err
+// truncated заменяет io.EOF на ErrTruncated, если часть значения уже была прочитана.
+func truncated(err error, partial bool) error {
+	if partial && err == io.EOF {
+		return ErrTruncated
 	}
-	b |= r.cache >> bits
-	r.cache &= 1<<bits - 1
-	return
+	return err
 }
 
 // ReadBool читает следующий бит и возвращает истину, если он равен 1.
 func (r *Reader) ReadBool() (b bool, err error) {
-	if r.bits == 0 {
-		r.cache, err = r.in.ReadByte()
-		if err != nil {
-			return
-		}
-		b = (r.cache & 0x80) != 0
-		r.cache, r.bits = r.cache&0x7f, 7
+	if err = r.need(1); err != nil {
 		return
 	}
 	r.bits--
-	b = (r.cache & (1 << r.bits)) != 0
-	r.cache &= 1<<r.bits - 1
-	return
+	return r.cache>>r.bits&1 != 0, nil
 }
 
 // Align выравнивает битовый поток по границе байта,
 // поэтому следующее чтение будет читать / использовать данные из следующего байта.
 // Возвращает количество непрочитанных / пропущенных бит.
 func (r *Reader) Align() (skipped uint8) {
-	skipped = r.bits
-	r.bits = 0 // no need to clear cache, will be overwritten on next read
+	skipped = r.bits % 8
+	r.bits -= skipped
 	return
 }
 
@@ -158,6 +306,23 @@ func (r *Reader) TryReadBits(n uint8) (u uint64) {
 	return
 }
 
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает PeekBits (),
+// возвращает предоставленные данные и сохраняет ошибку в поле TryError.
+func (r *Reader) TryPeekBits(n uint8) (u uint64) {
+	if r.TryError == nil {
+		u, r.TryError = r.PeekBits(n)
+	}
+	return
+}
+
+// Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает SkipBits (),
+// и сохраняет ошибку в поле TryError.
+func (r *Reader) TrySkipBits(n uint8) {
+	if r.TryError == nil {
+		r.TryError = r.SkipBits(n)
+	}
+}
+
 // Если была предыдущая ошибка TryError, она ничего не делает. В противном случае он вызывает ReadByte (),
 // возвращает предоставленные данные и сохраняет ошибку в поле TryError.
 func (r *Reader) TryReadByte() (b byte) {
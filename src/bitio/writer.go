@@ -1,20 +1,22 @@
 package bitio
 
 import (
-	"bufio"
 	"io"
 )
 
-type writerAndByteWriter interface {
-	io.Writer
-	io.ByteWriter
-}
+// bufferSize - размер буфера, в котором Writer накапливает байты перед записью в out
+// и из которого Reader отдает прочитанные байты.
+const bufferSize = 4096
 
+// Writer записывает битовый поток. Биты накапливаются в 64-битном аккумуляторе,
+// который целыми словами переносится в буфер, а буфер записывается в out,
+// когда заполнится, а также в Align и Close.
 type Writer struct {
-	out       writerAndByteWriter
-	wrapperbw *bufio.Writer // оболочка bufio.Writer, если цель не реализует io.ByteWriter
-	cache     byte          // здесь хранятся незаписанные биты
-	bits      byte         // количество незаписанных битов в кеше
+	out     io.Writer
+	buf     []byte // полные байты, еще не записанные в out
+	flushed int64  // количество байтов, записанных в out
+	cache   uint64 // здесь хранятся незаписанные биты: младшие bits битов, первым идет старший из них
+	bits    uint8  // количество незаписанных битов в кеше, всегда меньше 64
 	// TryError содержит первую ошибку, возникшую в методах TryXXX ().
 	TryError error
 }
@@ -23,31 +25,40 @@ type Writer struct {
 // Если не можем его закрывать, можно также принудительно очистить данные
 // вызовом Align().
 func NewWriter(out io.Writer) *Writer {
-	w := &Writer{}
-	var ok bool
-	w.out, ok = out.(writerAndByteWriter)
-	if !ok {
-		w.wrapperbw = bufio.NewWriter(out)
-		w.out = w.wrapperbw
-	}
-	return w
+	return &Writer{out: out, buf: make([]byte, 0, bufferSize)}
+}
+
+// Reset сбрасывает состояние Writer и направляет вывод в out, сохраняя выделенный буфер.
+// Незаписанные биты отбрасываются, TryError очищается.
+func (w *Writer) Reset(out io.Writer) {
+	w.out, w.buf, w.flushed = out, w.buf[:0], 0
+	w.cache, w.bits, w.TryError = 0, 0, nil
 }
 
 // Запись реализует io.Writer и предоставляет байтовый интерфейс для битового потока.
-// Это даст лучшую производительность, если базовый io.Writer выровнен
+// Это даст лучшую производительность, если битовый поток выровнен
 // до границы байта (иначе все отдельные байты распределяются на несколько байтов).
 // Границу байта можно обеспечить, вызвав Align ().
 func (w *Writer) Write(p []byte) (n int, err error) {
-	// w.bits будет таким же после записи 8 бит, поэтому нам не нужно это обновлять.
-	if w.bits == 0 {
-		return w.out.Write(p)
-	}
-	for i, b := range p {
-		if err = w.writeUnalignedByte(b); err != nil {
-			return i, err
+	if w.bits%8 != 0 {
+		for i, b := range p {
+			if err = w.WriteBitsUnsafe(uint64(b), 8); err != nil {
+				return i, err
+			}
 		}
+		return len(p), nil
+	}
+	w.drainBytes()
+	if len(w.buf)+len(p) <= cap(w.buf) {
+		w.buf = append(w.buf, p...)
+		return len(p), nil
 	}
-	return len(p), nil
+	if err = w.flush(); err != nil {
+		return 0, err
+	}
+	n, err = w.out.Write(p)
+	w.flushed += int64(n)
+	return
 }
 
 // WriteBits записывает n младших битов r.
@@ -57,106 +68,78 @@ func (w *Writer) WriteBits(r uint64, n uint8) (err error) {
 	return w.WriteBitsUnsafe((r & (1<<n - 1)), n)
 }
 
-// WriteBitsUnsafe записывает n младших битов r.
+// WriteBitsUnsafe записывает n младших битов r (n <= 64).
+// Биты r в позициях n и выше должны быть равны 0.
 func (w *Writer) WriteBitsUnsafe(r uint64, n uint8) (err error) {
-	newbits := w.bits + n
-	if newbits < 8 {
-		// r помещается в кеш, запись в out не произойдет
-		w.cache |= byte(r) << (8 - newbits)
-		w.bits = newbits
+	free := 64 - w.bits
+	if n < free {
+		// r помещается в кеш, запись в буфер не произойдет
+		w.cache = w.cache<<n | r
+		w.bits += n
 		return nil
 	}
-	if newbits > 8 {
-		// кеш будет заполнен, и будет больше бит для записи
-		// "Заполняем кеш" и записываем его
-		free := 8 - w.bits
-		err = w.out.WriteByte(w.cache | byte(r>>(n-free)))
-		if err != nil {
-			return
-		}
-		n -= free
-		// записываем целые байты
-		for n >= 8 {
-			n -= 8
-			// Нет необходимости маскировать r, преобразование в байты замаскирует более высокие биты
-			err = w.out.WriteByte(byte(r >> n))
-			if err != nil {
-				return
-			}
-		}
-		// Помещаем оставшееся в кеш
-		if n > 0 {
-			// Примечание: n <8 (в случае n = 8, 1 << n приведет к переполнению байта)
-			w.cache, w.bits = (byte(r)&((1<<n)-1))<<(8-n), n
-		} else {
-			w.cache, w.bits = 0, 0
-		}
-		return nil
+	// "Заполняем кеш" старшими битами r и переносим его в буфер целым словом;
+	// младшие биты r остаются в кеше (биты выше w.bits не используются)
+	w.cache = w.cache<<free | r>>(n-free)
+	w.buf = append(w.buf, byte(w.cache>>56), byte(w.cache>>48), byte(w.cache>>40), byte(w.cache>>32),
+		byte(w.cache>>24), byte(w.cache>>16), byte(w.cache>>8), byte(w.cache))
+	w.cache, w.bits = r, n-free
+	if len(w.buf) > cap(w.buf)-8 {
+		return w.flush()
 	}
-	// кэш будет заполнен ровно теми битами, которые нужно записать
-	bb := w.cache | byte(r)
-	w.cache, w.bits = 0, 0
-	return w.out.WriteByte(bb)
+	return nil
 }
 
-// WriteByte реализует io.ByteWriter.
-func (w *Writer) WriteByte(b byte) (err error) {
-	// w.bits будет таким же после записи 8 бит, поэтому нам не нужно это обновлять.
-	if w.bits == 0 {
-		return w.out.WriteByte(b)
+// drainBytes переносит из кеша в буфер все полные байты.
+func (w *Writer) drainBytes() {
+	for w.bits >= 8 {
+		w.bits -= 8
+		w.buf = append(w.buf, byte(w.cache>>w.bits))
 	}
-	return w.writeUnalignedByte(b)
 }
 
-// writeUnalignedByte записывает 8 бит, которые (могут быть) невыровненными.
-func (w *Writer) writeUnalignedByte(b byte) (err error) {
-	// w.bits будет таким же после записи 8 бит, поэтому нам не нужно это обновлять.
-	bits := w.bits
-	err = w.out.WriteByte(w.cache | b>>bits)
-	if err != nil {
-		return
+// flush записывает буфер в out.
+func (w *Writer) flush() error {
+	if len(w.buf) == 0 {
+		return nil
 	}
-	w.cache = (b & (1<<bits - 1)) << (8 - bits)
-	return
+	n, err := w.out.Write(w.buf)
+	w.flushed += int64(n)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// BitsWritten возвращает количество битов, записанных в битовый поток,
+// включая биты, пропущенные Align.
+func (w *Writer) BitsWritten() int64 {
+	return 8*(w.flushed+int64(len(w.buf))) + int64(w.bits)
+}
+
+// WriteByte реализует io.ByteWriter.
+func (w *Writer) WriteByte(b byte) (err error) {
+	return w.WriteBitsUnsafe(uint64(b), 8)
 }
 
 // WriteBool записывает один бит: 1, если параметр равен true, в противном случае - 0.
 func (w *Writer) WriteBool(b bool) (err error) {
-	if w.bits == 7 {
-		if b {
-			err = w.out.WriteByte(w.cache | 1)
-		} else {
-			err = w.out.WriteByte(w.cache)
-		}
-		if err != nil {
-			return
-		}
-		w.cache, w.bits = 0, 0
-		return nil
-	}
-	w.bits++
 	if b {
-		w.cache |= 1 << (8 - w.bits)
+		return w.WriteBitsUnsafe(1, 1)
 	}
-	return nil
+	return w.WriteBitsUnsafe(0, 1)
 }
 
 // Align выравнивает битовый поток по границе байта,
 // так что следующая запись начнется / перейдет в новый байт.
-// Если есть кешированные биты, они сначала записываются в вывод.
+// Кешированные биты и буфер записываются в вывод.
 // Возвращает количество пропущенных (не установленных, но все еще записанных) битов.
 func (w *Writer) Align() (skipped uint8, err error) {
-	if w.bits > 0 {
-		if err = w.out.WriteByte(w.cache); err != nil {
-			return
-		}
-
-		skipped = 8 - w.bits
-		w.cache, w.bits = 0, 0
-	}
-	if w.wrapperbw != nil {
-		err = w.wrapperbw.Flush()
+	if rem := w.bits % 8; rem > 0 {
+		skipped = 8 - rem
+		w.cache <<= skipped
+		w.bits += skipped
 	}
+	w.drainBytes()
+	err = w.flush()
 	return
 }
 
@@ -9,6 +9,9 @@ const (
 	_BWTS_MAX_BLOCK_SIZE = 1024 * 1024 * 1024 // 1 GB
 )
 
+// ErrTooLarge возвращается, если размер блока превышает MaxBWTSBlockSize.
+var ErrTooLarge = errors.New("bwt: block is too large")
+
 // Биективная версия преобразования Барроуза-Уиллера BWTS https://ru.qaz.wiki/wiki/Burrows–Wheeler_transform
 // Основное преимущество перед обычным BWT в том, что нет необходимости в первичном
 // индексе (отсюда биективность). BWTS примерно на 10% медленнее, чем BWT.
@@ -40,10 +43,7 @@ func (this *BWTS) Forward(src, dst []byte) (uint, uint, error) {
 	count := len(src)
 	count32 := int32(count)
 	if count > MaxBWTSBlockSize() {
-		// Неустранимая ошибка: вместо того, чтобы молча прервать преобразование,
-		// выдаем фатальную ошибку.
-		errMsg := fmt.Sprintf("The max BWTS block size is %v, got %v", MaxBWTSBlockSize(), count)
-		panic(errors.New(errMsg))
+		return 0, 0, fmt.Errorf("%w: max BWTS block size is %v, got %v", ErrTooLarge, MaxBWTSBlockSize(), count)
 	}
 	if count > len(dst) {
 		errMsg := fmt.Sprintf("Block size is %v, output buffer length is %v", count, len(dst))
@@ -159,10 +159,7 @@ func (this *BWTS) Inverse(src, dst []byte) (uint, uint, error) {
 	}
 	count := len(src)
 	if count > MaxBWTSBlockSize() {
-		// Неустранимая ошибка: вместо того, чтобы молча прервать преобразование,
-		// выдаем фатальную ошибку.
-		errMsg := fmt.Sprintf("The max BWTS block size is %v, got %v", MaxBWTSBlockSize(), count)
-		panic(errors.New(errMsg))
+		return 0, 0, fmt.Errorf("%w: max BWTS block size is %v, got %v", ErrTooLarge, MaxBWTSBlockSize(), count)
 	}
 	if count > len(dst) {
 		errMsg := fmt.Sprintf("Block size is %v, output buffer length is %v", count, len(dst))
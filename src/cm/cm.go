@@ -0,0 +1,19 @@
+// Package cm реализует сжатие байтов контекстным смешиванием (context mixing) -
+// режим наибольшего сжатия для выхода BWTS, заменяющий этапы MTF, ZRLE и энтропийного кодирования.
+//
+// Каждый байт кодируется по битам, начиная со старшего. Вероятность очередного бита
+// оценивают несколько моделей: контексты порядка 0, 1 и 2 (уже закодированные биты байта
+// и один-два предыдущих байта) и модель серий, которая предсказывает повтор предыдущего байта
+// с учетом длины текущей серии. Их оценки объединяет адаптивный логистический смеситель,
+// а результат уточняют два этапа SSE (APM) с контекстами порядка 0 и 1. По итоговой вероятности
+// бит кодируется двоичным арифметическим кодером.
+//
+// Модели одинаково обновляются в Writer и Reader, поэтому в поток не записываются никакие таблицы.
+// Перед каждым байтом кодируется бит конца потока с фиксированной малой вероятностью.
+package cm
+
+import "errors"
+
+// ErrTruncated возвращается, если сжатый поток закончился до признака конца потока.
+// Другие повреждения потока декодер не обнаруживает: их выявляют контрольные суммы контейнера.
+var ErrTruncated = errors.New("cm: truncated data")
@@ -0,0 +1,140 @@
+package cm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// encode сжимает data контекстным смешиванием.
+func encode(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decode распаковывает stream.
+func decode(stream []byte) ([]byte, error) {
+	return ioutil.ReadAll(NewReader(bytes.NewReader(stream)))
+}
+
+func TestRoundTripTestData(t *testing.T) {
+	files, err := filepath.Glob("../../testData/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decode(encode(t, data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: data mismatch", name)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	if stream := encode(t, nil); len(stream) != 0 {
+		t.Fatalf("empty input compressed to %d bytes", len(stream))
+	}
+	if _, err := NewReader(bytes.NewReader(nil)).ReadByte(); err != io.EOF {
+		t.Fatalf("empty stream: got %v, want io.EOF", err)
+	}
+}
+
+func TestSingleSymbol(t *testing.T) {
+	for _, n := range []int{1, 2, 100000} {
+		data := bytes.Repeat([]byte{0}, n)
+		stream := encode(t, data)
+		got, err := decode(stream)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%d zero bytes: got %d bytes, %v", n, len(got), err)
+		}
+		// Модель серий предсказывает повтор почти наверняка
+		if n == 100000 && len(stream) > n/100 {
+			t.Errorf("%d zero bytes compressed to %d bytes", n, len(stream))
+		}
+	}
+}
+
+// Close сбрасывает модели: следующий поток того же Writer сжимается так же,
+// как новым Writer, и распаковывается отдельно (fd сжимает так блоки).
+func TestCloseResetsModel(t *testing.T) {
+	first, err := ioutil.ReadFile("../../testData/normSmall.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := bytes.Repeat([]byte("abcabd"), 100)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, data := range [][]byte{first, second} {
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := encode(t, first)
+	if !bytes.HasPrefix(buf.Bytes(), want) {
+		t.Fatal("first stream differs from a new Writer's")
+	}
+	if rest := buf.Bytes()[len(want):]; !bytes.Equal(rest, encode(t, second)) {
+		t.Fatal("stream written after Close differs from a new Writer's")
+	}
+	got, err := decode(buf.Bytes()[len(want):])
+	if err != nil || !bytes.Equal(got, second) {
+		t.Fatalf("second stream: got %q, %v", got, err)
+	}
+}
+
+// testStream возвращает normSmall.txt и его сжатую форму.
+func testStream(t *testing.T) (data, stream []byte) {
+	data, err := ioutil.ReadFile("../../testData/normSmall.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, encode(t, data)
+}
+
+func TestTruncated(t *testing.T) {
+	_, stream := testStream(t)
+	for n := 1; n < len(stream); n++ {
+		if _, err := decode(stream[:n]); !errors.Is(err, ErrTruncated) {
+			t.Fatalf("stream truncated to %d of %d bytes: got %v, want ErrTruncated", n, len(stream), err)
+		}
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	data, stream := testStream(t)
+	corrupt := make([]byte, len(stream))
+	for i := range stream {
+		copy(corrupt, stream)
+		corrupt[i] ^= 1 << uint(i%8)
+		// Повреждение не обнаруживается (это делают контрольные суммы fd), но декодер
+		// должен остановиться на признаке конца потока или с ErrTruncated
+		got, err := decode(corrupt)
+		if err != nil && !errors.Is(err, ErrTruncated) {
+			t.Errorf("bit %d of byte %d: unexpected error %v", i%8, i, err)
+		}
+		if err == nil && bytes.Equal(got, data) && i < len(stream)-4 {
+			t.Errorf("bit %d of byte %d: corruption did not change the data", i%8, i)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package cm
+
+import "io"
+
+// Двоичный арифметический кодер без переноса (как в семействе PAQ): интервал [x1, x2]
+// сужается на каждом бите, а совпавшие старшие байты границ выводятся.
+// Вероятности передаются в единицах 1/probOne.
+const (
+	probBits = 16
+	probOne  = 1 << probBits
+)
+
+// encoder - кодирующая часть двоичного арифметического кодера.
+type encoder struct {
+	out    io.ByteWriter
+	x1, x2 uint32 // Границы интервала
+	err    error  // Первая ошибка записи
+}
+
+func newEncoder(out io.ByteWriter) *encoder {
+	return &encoder{out: out, x2: 0xFFFFFFFF}
+}
+
+// encode кодирует бит bit, вероятность единицы которого равна p/probOne (0 < p < probOne).
+func (e *encoder) encode(bit int, p uint32) {
+	xmid := e.x1 + uint32(uint64(e.x2-e.x1)*uint64(p)>>probBits)
+	if bit != 0 {
+		e.x2 = xmid
+	} else {
+		e.x1 = xmid + 1
+	}
+	for (e.x1^e.x2)&0xFF000000 == 0 {
+		if err := e.out.WriteByte(byte(e.x2 >> 24)); err != nil && e.err == nil {
+			e.err = err
+		}
+		e.x1 <<= 8
+		e.x2 = e.x2<<8 | 0xFF
+	}
+}
+
+// flush выводит нижнюю границу интервала целиком: декодер читает ровно столько байтов,
+// сколько записал кодер.
+func (e *encoder) flush() error {
+	for i := 0; i < 4; i++ {
+		if err := e.out.WriteByte(byte(e.x1 >> 24)); err != nil && e.err == nil {
+			e.err = err
+		}
+		e.x1 <<= 8
+	}
+	return e.err
+}
+
+// decoder - декодирующая часть двоичного арифметического кодера.
+type decoder struct {
+	in     io.ByteReader
+	x1, x2 uint32 // Границы интервала
+	x      uint32 // Первые 4 байта непрочитанной части потока
+	err    error  // Первая ошибка чтения; после нее декодер получает нулевые байты
+}
+
+// newDecoder читает начало потока. Возвращает io.EOF, если поток пуст.
+func newDecoder(in io.ByteReader) (*decoder, error) {
+	d := &decoder{in: in, x2: 0xFFFFFFFF}
+	b, err := in.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	d.x = uint32(b)
+	for i := 0; i < 3; i++ {
+		d.x = d.x<<8 | uint32(d.readByte())
+	}
+	return d, d.err
+}
+
+// readByte читает следующий байт; конец потока запоминается как ErrTruncated.
+func (d *decoder) readByte() byte {
+	b, err := d.in.ReadByte()
+	if err != nil && d.err == nil {
+		if err == io.EOF {
+			err = ErrTruncated
+		}
+		d.err = err
+	}
+	return b
+}
+
+// decode декодирует бит, вероятность единицы которого равна p/probOne.
+func (d *decoder) decode(p uint32) int {
+	xmid := d.x1 + uint32(uint64(d.x2-d.x1)*uint64(p)>>probBits)
+	bit := 0
+	if d.x <= xmid {
+		bit = 1
+		d.x2 = xmid
+	} else {
+		d.x1 = xmid + 1
+	}
+	for (d.x1^d.x2)&0xFF000000 == 0 {
+		d.x1 <<= 8
+		d.x2 = d.x2<<8 | 0xFF
+		d.x = d.x<<8 | uint32(d.readByte())
+	}
+	return bit
+}
@@ -0,0 +1,150 @@
+package cm
+
+// Вероятности внутри модели - 12-битные (в единицах 1/4096), а логарифмы отношения
+// шансов (stretch) лежат в пределах [-2047, 2047] в единицах 1/256.
+
+// squashPoints - значения squash в точках -2048, -1920, ..., 2048.
+var squashPoints = [33]int32{
+	1, 2, 3, 6, 10, 16, 27, 45, 73, 120, 194, 310, 488, 747, 1101, 1546,
+	2047, 2549, 2994, 3348, 3607, 3785, 3901, 3975, 4024, 4050, 4068, 4079, 4085, 4089, 4092, 4093, 4094,
+}
+
+// squash возвращает вероятность 4096/(1+e^(-d/256)), d ограничивается пределами [-2047, 2047].
+func squash(d int32) int32 {
+	if d > 2047 {
+		d = 2047
+	}
+	if d < -2047 {
+		d = -2047
+	}
+	w := d & 127
+	i := d>>7 + 16
+	return (squashPoints[i]*(128-w) + squashPoints[i+1]*w + 64) >> 7
+}
+
+// stretchTable - обратная к squash функция ln(p/(1-p)) для 12-битных вероятностей.
+var stretchTable = func() (t [4096]int16) {
+	pi := int32(0)
+	for x := int32(-2047); x <= 2047; x++ {
+		v := squash(x)
+		for i := pi; i <= v; i++ {
+			t[i] = int16(x)
+		}
+		pi = v + 1
+	}
+	for i := pi; i < 4096; i++ {
+		t[i] = 2047
+	}
+	return
+}()
+
+func stretch(p int32) int32 {
+	return int32(stretchTable[p])
+}
+
+// counterRates[n] - скорость обновления счетчика, видевшего n битов: 65536/(n+1.5).
+var counterRates = func() (t [1024]int32) {
+	for i := range t {
+		t[i] = 2 * 65536 / int32(2*i+3)
+	}
+	return
+}()
+
+// counter - адаптивная вероятность единицы: старшие 22 бита - вероятность,
+// младшие 10 - количество учтенных битов, не больше предела. Пока битов мало, вероятность
+// равна их частоте, а потом следит за статистикой со скоростью 1/(предел+1.5).
+type counter uint32
+
+const counterInit = counter(1 << 31)
+
+// p возвращает 12-битную вероятность единицы.
+func (c counter) p() int32 {
+	return int32(c >> 20)
+}
+
+// update учитывает бит bit; limit (< 1024) - предел количества учтенных битов.
+func (c *counter) update(bit int, limit uint32) {
+	n := uint32(*c) & 1023
+	p := int64(*c >> 10)
+	if n < limit {
+		*c++
+	} else {
+		*c = *c&^1023 | counter(limit)
+	}
+	delta := (int64(bit)<<22 - p) * int64(counterRates[n]) >> 6
+	*c += counter(uint32(delta) &^ 1023)
+}
+
+// mixer объединяет оценки моделей: вероятность - squash от взвешенной суммы их stretch.
+// Веса выбираются по контексту и обучаются градиентным спуском на ошибке кодирования.
+type mixer struct {
+	weights []int32 // Наборы весов, по nInputs в каждом, в единицах 1/65536
+	inputs  [nInputs]int32
+	n       int     // Количество добавленных входов
+	set     []int32 // Набор весов, выбранный mix
+	pr      int32   // Последняя вероятность
+}
+
+func newMixer(contexts int) *mixer {
+	m := &mixer{weights: make([]int32, contexts*nInputs)}
+	for i := range m.weights {
+		m.weights[i] = 1 << 14
+	}
+	return m
+}
+
+// add добавляет вход - stretch оценки вероятности.
+func (m *mixer) add(st int32) {
+	m.inputs[m.n] = st
+	m.n++
+}
+
+// mix возвращает 12-битную вероятность единицы по набору весов ctx.
+func (m *mixer) mix(ctx int) int32 {
+	m.set = m.weights[ctx*nInputs : ctx*nInputs+nInputs]
+	dot := int64(0)
+	for i, x := range m.inputs[:m.n] {
+		dot += int64(x) * int64(m.set[i])
+	}
+	m.pr = squash(int32(dot >> 16))
+	return m.pr
+}
+
+// update обучает выбранный набор весов на бите bit и очищает входы.
+func (m *mixer) update(bit int) {
+	err := (int32(bit)<<12 - m.pr) * mixerRate
+	for i, x := range m.inputs[:m.n] {
+		m.set[i] += (x*err + 1<<13) >> 14
+	}
+	m.n = 0
+}
+
+// apm (adaptive probability map, SSE) уточняет вероятность по контексту: для каждого контекста
+// хранится кусочно-линейная функция от stretch вероятности с 24 узлами.
+type apm struct {
+	t     []uint16 // Значения в узлах, 16-битные вероятности
+	index int      // Узел, ближайший к последней вероятности
+}
+
+func newAPM(contexts int) *apm {
+	a := &apm{t: make([]uint16, contexts*24)}
+	for i := range a.t {
+		a.t[i] = uint16(squash(int32((i%24*2+1)*4096/48-2048)) * 16)
+	}
+	return a
+}
+
+// refine возвращает уточненную 12-битную вероятность pr в контексте ctx.
+func (a *apm) refine(pr int32, ctx int) int32 {
+	s := (stretch(pr) + 2048) * 23
+	w := s & 0xFFF // Вес следующего узла
+	i := ctx*24 + int(s>>12)
+	a.index = i + int(w>>11)
+	return (int32(a.t[i])*(4096-w) + int32(a.t[i+1])*w) >> 16
+}
+
+// update сдвигает ближайший узел к биту bit со скоростью 1/2^apmRate.
+func (a *apm) update(bit int) {
+	g := int32(bit)<<16 + int32(bit)<<apmRate - int32(bit) - int32(bit)
+	a.t[a.index] = uint16(int32(a.t[a.index]) + (g-int32(a.t[a.index]))>>apmRate)
+}
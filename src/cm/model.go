@@ -0,0 +1,145 @@
+package cm
+
+const (
+	nInputs   = 7  // Количество входов смесителя, включая постоянный
+	mixerRate = 4  // Скорость обучения смесителя
+	apmRate   = 7  // Скорость обновления APM
+	o2Bits    = 22 // Логарифм размера таблицы контекстов порядка 2
+	maxRun    = 15 // Наибольшая различаемая длина серии
+	// Пределы счетчиков: чем меньше предел, тем быстрее счетчик забывает старую статистику.
+	// Выход BWTS - последовательность участков с разной статистикой, поэтому пределы невелики,
+	// а оценка порядка 0 должна следить за текущим участком быстрее всех.
+	o0Limit  = 7
+	o1Limit  = 30
+	o2Limit  = 20
+	runLimit = 250
+)
+
+// model оценивает вероятность очередного бита и обучается на закодированных битах.
+type model struct {
+	c0     uint32 // Закодированные биты текущего байта с ведущей единицей (1..255)
+	c1, c2 uint32 // Два предыдущих байта
+	run    uint32 // Длина серии одинаковых байтов, которой заканчивается c1 (не больше maxRun)
+	o2ctx  uint32 // Начало строки контекста порядка 2 в o2
+	bitPos uint32 // Номер кодируемого бита в байте (0 - старший)
+
+	o0   [256]counter
+	o1   []counter                     // Контекст c1, c0
+	o2   []counter                     // Хеш c2, c1 и c0
+	f1   []uint16                      // Быстро адаптирующиеся оценки по контексту c1, c0
+	runs [(maxRun + 1) * 8 * 2]counter // Длина серии, номер бита и ожидаемый бит
+
+	// Счетчики, выбранные для текущего бита
+	s0, s1, s2, sr *counter
+	sf1            *uint16
+
+	mx     *mixer
+	a1, a2 *apm
+	pm, pr int32 // Вероятности смесителя и итоговая
+}
+
+func newModel() *model {
+	m := &model{
+		c0: 1,
+		o1: make([]counter, 1<<16),
+		o2: make([]counter, 1<<o2Bits),
+		f1: make([]uint16, 1<<16),
+		mx: newMixer(maxRun + 2),
+		a1: newAPM(256),
+		a2: newAPM(1 << 16),
+	}
+	for i := range m.o0 {
+		m.o0[i] = counterInit
+	}
+	for i := range m.o1 {
+		m.o1[i] = counterInit
+		m.f1[i] = 1 << 15
+	}
+	for i := range m.o2 {
+		m.o2[i] = counterInit
+	}
+	for i := range m.runs {
+		m.runs[i] = counterInit
+	}
+	m.predict()
+	return m
+}
+
+// p возвращает 16-битную вероятность того, что следующий бит равен 1.
+func (m *model) p() uint32 {
+	return uint32(m.pr)<<4 | 8
+}
+
+// predict вычисляет вероятность следующего бита.
+func (m *model) predict() {
+	c0 := m.c0
+	m.s0 = &m.o0[c0]
+	m.s1 = &m.o1[m.c1<<8|c0]
+	m.s2 = &m.o2[m.o2ctx+c0]
+	m.sf1 = &m.f1[m.c1<<8|c0]
+	mx := m.mx
+	mx.add(256)
+	mx.add(stretch(m.s0.p()))
+	mx.add(stretch(m.s1.p()))
+	mx.add(stretch(m.s2.p()))
+	mx.add(stretch(int32(*m.sf1 >> 4)))
+	// Модель серий: если начало байта совпадает с предыдущим байтом, ожидается его следующий бит.
+	ctx := 0
+	if (m.c1|256)>>(8-m.bitPos) == c0 {
+		expected := m.c1 >> (7 - m.bitPos) & 1
+		m.sr = &m.runs[(m.run*8+m.bitPos)*2+expected]
+		mx.add(stretch(m.sr.p()))
+		mx.add(int32(expected*2-1) * 256)
+		ctx = int(m.run) + 1
+	} else {
+		m.sr = nil
+		mx.add(0)
+		mx.add(0)
+	}
+	// Набор весов смесителя выбирается по длине серии
+	m.pm = mx.mix(ctx)
+	p1 := m.a1.refine(m.pm, int(c0))
+	p2 := m.a2.refine(m.pm, int(c0|m.c1<<8))
+	// Итоговая вероятность - взвешенное среднее оценки смесителя и ее уточнений
+	pr := (m.pm + p1 + p2*2 + 2) >> 2
+	if pr < 1 {
+		pr = 1
+	} else if pr > 4095 {
+		pr = 4095
+	}
+	m.pr = pr
+}
+
+// update учитывает закодированный бит и вычисляет вероятность следующего.
+func (m *model) update(bit int) {
+	m.mx.update(bit)
+	m.a1.update(bit)
+	m.a2.update(bit)
+	m.s0.update(bit, o0Limit)
+	m.s1.update(bit, o1Limit)
+	m.s2.update(bit, o2Limit)
+	if bit != 0 {
+		*m.sf1 += (65535 - *m.sf1) >> 3
+	} else {
+		*m.sf1 -= *m.sf1 >> 3
+	}
+	if m.sr != nil {
+		m.sr.update(bit, runLimit)
+	}
+	m.c0 = m.c0<<1 | uint32(bit)
+	m.bitPos++
+	if m.bitPos == 8 {
+		c := m.c0 & 0xFF
+		if c == m.c1 {
+			if m.run < maxRun {
+				m.run++
+			}
+		} else {
+			m.run = 0
+		}
+		m.c2, m.c1 = m.c1, c
+		m.o2ctx = (m.c2<<8 | m.c1) * 0x9E3779B1 >> (32 - o2Bits + 8) << 8
+		m.c0, m.bitPos = 1, 0
+	}
+	m.predict()
+}
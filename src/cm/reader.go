@@ -0,0 +1,77 @@
+package cm
+
+import (
+	"bufio"
+	"io"
+)
+
+// Reader - это реализация считывателя контекстного смешивания.
+// Он также реализует io.ByteReader.
+type Reader struct {
+	in    io.ByteReader
+	dec   *decoder // Декодер, создается при чтении первого байта
+	model *model
+	eof   bool  // Сообщает, был ли прочитан признак конца потока
+	err   error // Первая ошибка декодирования
+}
+
+// NewReader возвращает новый Reader, используя указанный io.Reader в качестве ввода (источника).
+func NewReader(in io.Reader) *Reader {
+	bin, ok := in.(io.ByteReader)
+	if !ok {
+		bin = bufio.NewReader(in)
+	}
+	return &Reader{in: bin}
+}
+
+// Чтение распаковывает до len (p) байтов из источника.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	for i := range p {
+		if p[i], err = r.ReadByte(); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+// ReadByte распаковывает один байт.
+// Возвращает io.EOF после признака конца потока, а также если поток пуст.
+func (r *Reader) ReadByte() (byte, error) {
+	if r.eof {
+		return 0, io.EOF
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.dec == nil {
+		dec, err := newDecoder(r.in)
+		if err == io.EOF {
+			r.eof = true
+			return 0, io.EOF
+		}
+		if err != nil {
+			r.err = err
+			return 0, err
+		}
+		r.dec, r.model = dec, newModel()
+	}
+	if r.dec.decode(eofProb) != 0 {
+		if r.dec.err != nil {
+			r.err = r.dec.err
+			return 0, r.err
+		}
+		r.eof = true
+		return 0, io.EOF
+	}
+	c := 0
+	for i := 0; i < 8; i++ {
+		bit := r.dec.decode(r.model.p())
+		r.model.update(bit)
+		c = c<<1 | bit
+	}
+	if r.dec.err != nil {
+		r.err = r.dec.err
+		return 0, r.err
+	}
+	return byte(c), nil
+}
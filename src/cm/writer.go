@@ -0,0 +1,66 @@
+package cm
+
+import (
+	"bufio"
+	"io"
+)
+
+// eofProb - вероятность признака конца потока перед байтом в единицах 1/probOne:
+// пока поток не закончился, признак стоит меньше 1/40000 бита на байт.
+const eofProb = 1
+
+// Writer - это реализация модуля записи контекстного смешивания.
+// Должен быть закрыт для правильной отправки признака конца потока.
+type Writer struct {
+	out   *bufio.Writer
+	enc   *encoder
+	model *model // Модель, создается при записи первого байта
+}
+
+// NewWriter возвращает новый Writer, используя указанный io.Writer в качестве вывода.
+// Модели занимают около 20 МБ памяти.
+func NewWriter(out io.Writer) *Writer {
+	w := &Writer{out: bufio.NewWriter(out)}
+	w.enc = newEncoder(w.out)
+	return w
+}
+
+// Write записывает сжатую форму p в базовый io.Writer.
+// Сжатые данные не обязательно сбрасываются до закрытия Writer.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	for i, b := range p {
+		if err = w.WriteByte(b); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+// WriteByte записывает сжатую форму b в базовый io.Writer.
+func (w *Writer) WriteByte(b byte) error {
+	if w.model == nil {
+		w.model = newModel()
+	}
+	w.enc.encode(0, eofProb)
+	for i := 7; i >= 0; i-- {
+		bit := int(b>>uint(i)) & 1
+		w.enc.encode(bit, w.model.p())
+		w.model.update(bit)
+	}
+	return w.enc.err
+}
+
+// Close записывает признак конца потока и сбрасывает сжатые данные в базовый io.Writer.
+// Базовый io.Writer не закрывается. Если не было записано ни одного байта,
+// ничего не записывается.
+func (w *Writer) Close() error {
+	if w.model != nil {
+		w.enc.encode(1, eofProb)
+		if err := w.enc.flush(); err != nil {
+			return err
+		}
+		w.model = nil
+		w.enc = newEncoder(w.out)
+	}
+	return w.out.Flush()
+}
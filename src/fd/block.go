@@ -0,0 +1,396 @@
+package fd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/farit2000/compressor/src/ans"
+	"github.com/farit2000/compressor/src/arith"
+	"github.com/farit2000/compressor/src/bwt"
+	"github.com/farit2000/compressor/src/cm"
+	"github.com/farit2000/compressor/src/huffman"
+	"github.com/farit2000/compressor/src/mtf"
+	"github.com/farit2000/compressor/src/rle"
+	"github.com/farit2000/compressor/src/zrle"
+)
+
+const (
+	// MinBlockSize - минимальный размер блока
+	MinBlockSize = 100 * 1024
+	// MaxBlockSize - максимальный размер блока
+	MaxBlockSize = 64 * 1024 * 1024
+	// DefaultBlockSize - размер блока по умолчанию
+	DefaultBlockSize = 4 * 1024 * 1024
+)
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+var (
+	// ErrCorrupt возвращается, если структура сжатых данных нарушена.
+	ErrCorrupt = errors.New("fd: corrupt data")
+	// ErrTruncated возвращается, если сжатые данные закончились раньше конца потока.
+	ErrTruncated = errors.New("fd: unexpected end of data")
+)
+
+// BlockError сообщает, какой блок не удалось распаковать.
+// errors.Is(err, ErrCorrupt) возвращает true для BlockError,
+// а errors.Is и errors.As с ошибками этапов сжатия (например, huffman.ErrTruncated)
+// проверяют исходную ошибку Err.
+type BlockError struct {
+	Block int   // Номер блока, начиная с 0
+	Err   error // Ошибка этапа распаковки
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("%v: block %d: %v", ErrCorrupt, e.Block, e.Err)
+}
+
+// Unwrap возвращает исходную ошибку.
+func (e *BlockError) Unwrap() error { return e.Err }
+
+// Is позволяет сравнивать BlockError с ErrCorrupt через errors.Is.
+func (e *BlockError) Is(target error) bool {
+	return target == ErrCorrupt
+}
+
+// CheckBlockSize проверяет, что размер блока лежит в допустимых пределах.
+func CheckBlockSize(size int) error {
+	if size < MinBlockSize || size > MaxBlockSize {
+		return fmt.Errorf("fd: block size %d is out of range [%d, %d]", size, MinBlockSize, MaxBlockSize)
+	}
+	return nil
+}
+
+// blockEncoder сжимает отдельные блоки: BWTS -> RLE -> MTF -> ZRLE -> Huffman (арифметический код или rANS)
+// или BWTS -> контекстное смешивание.
+// Хранит буферы BWTS между блоками, поэтому не может использоваться конкурентно.
+type blockEncoder struct {
+	flags   Flags
+	huffman huffman.Options
+	arith   arith.Options
+	ans     ans.Options
+	bwts    *bwt.BWTS
+	buf     []byte
+}
+
+func newBlockEncoder(h *Header) (*blockEncoder, error) {
+	bwts, err := bwt.NewBWTS()
+	if err != nil {
+		return nil, err
+	}
+	ho, ao, no := entropyOptions(h)
+	return &blockEncoder{flags: h.Flags, huffman: ho, arith: ao, ans: no, bwts: bwts}, nil
+}
+
+// encode сжимает block и возвращает сжатые данные.
+func (e *blockEncoder) encode(block []byte) ([]byte, error) {
+	data := block
+	if e.flags.Has(FlagBWTS) {
+		if cap(e.buf) < len(block) {
+			e.buf = make([]byte, len(block))
+		}
+		data = e.buf[:len(block)]
+		if _, _, err := e.bwts.Forward(block, data); err != nil {
+			return nil, err
+		}
+	}
+	// Флаги блока: этапы, которые действительно были применены к этому блоку.
+	flags := e.flags &^ FlagRLE
+	if e.flags.Has(FlagRLE) {
+		var ok bool
+		if data, ok = rle.RunLengthEncode(data); ok {
+			flags |= FlagRLE
+		}
+	}
+	var alphabet []byte
+	if e.flags.Has(FlagMTF) {
+		alphabet = mtf.AlphabetCreate(data)
+		data = mtf.SymbolTable(alphabet).Encode(data)
+	}
+	header := appendBlockHeader(make([]byte, 0, maxBlockHeaderSize), flags, alphabet)
+	if e.flags&flagsEntropy == 0 {
+		return append(header, data...), nil
+	}
+	var out bytes.Buffer
+	out.Write(header)
+	var w symbolWriter
+	switch {
+	case e.flags.Has(FlagArith):
+		w = arith.NewWriterOptions(&out, &e.arith)
+	case e.flags.Has(FlagANS):
+		w = ans.NewWriterOptions(&out, &e.ans)
+	case e.flags.Has(FlagCM):
+		w = cmWriter{cm.NewWriter(&out)}
+	default:
+		w = huffmanWriter{huffman.NewWriterOptions(&out, &e.huffman)}
+	}
+	if e.flags.Has(FlagZRLE) {
+		for _, s := range zrle.Encode(data) {
+			if err := w.WriteSymbol(int(s)); err != nil {
+				return nil, err
+			}
+		}
+	} else if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// symbolWriter - энтропийный кодер последнего этапа: huffman.Writer, arith.Writer, ans.Writer или cm.Writer.
+type symbolWriter interface {
+	io.WriteCloser
+	WriteSymbol(s int) error
+}
+
+// symbolReader - энтропийный декодер последнего этапа: huffman.Reader, arith.Reader, ans.Reader или cm.Reader.
+type symbolReader interface {
+	io.Reader
+	ReadSymbol() (int, error)
+}
+
+// huffmanWriter приводит huffman.Writer к symbolWriter.
+type huffmanWriter struct {
+	*huffman.Writer
+}
+
+func (w huffmanWriter) WriteSymbol(s int) error {
+	return w.Writer.WriteSymbol(huffman.ValueType(s))
+}
+
+// huffmanReader приводит huffman.Reader к symbolReader.
+type huffmanReader struct {
+	*huffman.Reader
+}
+
+func (r huffmanReader) ReadSymbol() (int, error) {
+	s, err := r.Reader.ReadSymbol()
+	return int(s), err
+}
+
+// cmWriter приводит cm.Writer к symbolWriter. Контекстное смешивание кодирует только байты,
+// поэтому вместе с ZRLE не применяется.
+type cmWriter struct {
+	*cm.Writer
+}
+
+func (w cmWriter) WriteSymbol(s int) error {
+	if s < 0 || s > 255 {
+		return fmt.Errorf("fd: symbol %d does not fit in a byte", s)
+	}
+	return w.WriteByte(byte(s))
+}
+
+// cmReader приводит cm.Reader к symbolReader.
+type cmReader struct {
+	*cm.Reader
+}
+
+func (r cmReader) ReadSymbol() (int, error) {
+	b, err := r.ReadByte()
+	return int(b), err
+}
+
+// blockDecoder восстанавливает блоки, сжатые blockEncoder.
+type blockDecoder struct {
+	flags   Flags
+	huffman huffman.Options
+	arith   arith.Options
+	ans     ans.Options
+	bwts    *bwt.BWTS
+}
+
+func newBlockDecoder(h *Header) (*blockDecoder, error) {
+	bwts, err := bwt.NewBWTS()
+	if err != nil {
+		return nil, err
+	}
+	ho, ao, no := entropyOptions(h)
+	return &blockDecoder{flags: h.Flags, huffman: ho, arith: ao, ans: no, bwts: bwts}, nil
+}
+
+// entropyOptions возвращает параметры кодирования Хаффмана, арифметического кодирования
+// и rANS для блоков потока с заголовком h.
+func entropyOptions(h *Header) (huffman.Options, arith.Options, ans.Options) {
+	ho, ao, no := h.Huffman, h.Arith, h.ANS
+	if h.Flags.Has(FlagZRLE) {
+		ho.AlphabetSize = zrle.AlphabetSize
+		ao.AlphabetSize = zrle.AlphabetSize
+		no.AlphabetSize = zrle.AlphabetSize
+	}
+	return ho, ao, no
+}
+
+// newSymbolReader возвращает энтропийный декодер блока, выбранный флагами.
+func (d *blockDecoder) newSymbolReader(data []byte) symbolReader {
+	switch {
+	case d.flags.Has(FlagArith):
+		return arith.NewReaderOptions(bytes.NewReader(data), &d.arith)
+	case d.flags.Has(FlagANS):
+		return ans.NewReaderOptions(bytes.NewReader(data), &d.ans)
+	case d.flags.Has(FlagCM):
+		return cmReader{cm.NewReader(bytes.NewReader(data))}
+	}
+	return huffmanReader{huffman.NewReaderOptions(bytes.NewReader(data), &d.huffman)}
+}
+
+// decode распаковывает сжатый блок, исходный размер которого равен size.
+func (d *blockDecoder) decode(payload []byte, size int) ([]byte, error) {
+	flags, alphabet, data, err := d.readBlockHeader(payload)
+	if err != nil {
+		return nil, err
+	}
+	if flags.Has(FlagZRLE) {
+		if data, err = d.decodeZeroRuns(data, size); err != nil {
+			return nil, err
+		}
+	} else if flags&flagsEntropy != 0 {
+		// Выход декодера не длиннее исходного блока: лишний байт означает повреждение,
+		// а ограничение не дает поврежденному потоку разрастись
+		if data, err = ioutil.ReadAll(io.LimitReader(d.newSymbolReader(data), int64(size)+1)); err != nil {
+			return nil, err
+		}
+	}
+	if flags.Has(FlagMTF) {
+		if data, err = mtf.SymbolTable(alphabet).Decode(data); err != nil {
+			return nil, err
+		}
+	}
+	if flags.Has(FlagRLE) {
+		if data, err = rle.RunLengthDecode(data, size); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) != size {
+		return nil, fmt.Errorf("block size is %d, expected %d", len(data), size)
+	}
+	if !flags.Has(FlagBWTS) {
+		return data, nil
+	}
+	block := make([]byte, size)
+	if _, _, err := d.bwts.Inverse(data, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// maxBlockHeaderSize - наибольший размер заголовка блока: флаги и полная битовая карта алфавита.
+const maxBlockHeaderSize = 1 + 2 + 16*2
+
+// appendBlockHeader дописывает к buf заголовок блока: байт флагов блока и,
+// если применялось MTF, битовую карту алфавита MTF.
+func appendBlockHeader(buf []byte, flags Flags, alphabet []byte) []byte {
+	buf = append(buf, byte(flags))
+	if flags.Has(FlagMTF) {
+		buf = mtf.AppendBitmap(buf, alphabet)
+	}
+	return buf
+}
+
+// readBlockHeader читает заголовок блока из начала payload и возвращает флаги блока,
+// алфавит MTF и данные, следующие за заголовком.
+func (d *blockDecoder) readBlockHeader(payload []byte) (flags Flags, alphabet, data []byte, err error) {
+	if len(payload) == 0 {
+		return 0, nil, nil, errors.New("block flags are missing")
+	}
+	flags = Flags(payload[0])
+	if flags&^d.flags != 0 || flags&^FlagRLE != d.flags&^FlagRLE {
+		return 0, nil, nil, fmt.Errorf("block flags %#x do not match header flags %#x", byte(flags), byte(d.flags))
+	}
+	data = payload[1:]
+	if flags.Has(FlagMTF) {
+		var n int
+		if alphabet, n, err = mtf.ReadBitmap(data); err != nil {
+			return 0, nil, nil, err
+		}
+		data = data[n:]
+	}
+	return flags, alphabet, data, nil
+}
+
+// decodeZeroRuns читает символы энтропийного кода и восстанавливает из них выход MTF.
+// Выход MTF не длиннее исходного блока размера size, поэтому символы декодируются
+// по одному и поврежденный поток отвергается, не дочитывая его до конца.
+func (d *blockDecoder) decodeZeroRuns(data []byte, size int) ([]byte, error) {
+	r := d.newSymbolReader(data)
+	z := zrle.NewDecoder(size)
+	for {
+		s, err := r.ReadSymbol()
+		if err == io.EOF {
+			return z.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := z.WriteSymbol(uint16(s)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// writeBlock записывает кадр блока: исходный размер, контрольную сумму исходных данных,
+// размер сжатых данных и сами данные. Сжатые данные начинаются с заголовка блока:
+// байта флагов блока - этапов, примененных к блоку (например, RLE не применяется,
+// если оно не уменьшает размер), - и битовой карты алфавита MTF.
+func writeBlock(w io.Writer, size int, crc uint32, payload []byte) error {
+	buf := make([]byte, 0, 4+2*binary.MaxVarintLen64)
+	buf = appendUvarint(buf, uint64(size))
+	buf = appendUint32(buf, crc)
+	buf = appendUvarint(buf, uint64(len(payload)))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// writeEnd записывает кадр конца потока: нулевой исходный размер и
+// контрольную сумму всего потока.
+func writeEnd(w io.Writer, crc uint32) error {
+	_, err := w.Write(appendUint32([]byte{0}, crc))
+	return err
+}
+
+// readBlock читает кадр блока. Для кадра конца потока возвращает size == 0
+// и контрольную сумму всего потока.
+// maxSize - наибольший допустимый исходный размер блока.
+func readBlock(r byteReader, maxSize int) (size int, crc uint32, payload []byte, err error) {
+	size64, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, nil, noEOF(err)
+	}
+	if size64 > uint64(maxSize) {
+		return 0, 0, nil, fmt.Errorf("%w: block size %d exceeds %d", ErrCorrupt, size64, maxSize)
+	}
+	var crcBuf [4]byte
+	if _, err = io.ReadFull(r, crcBuf[:]); err != nil {
+		return 0, 0, nil, noEOF(err)
+	}
+	crc = binary.BigEndian.Uint32(crcBuf[:])
+	if size64 == 0 {
+		return 0, crc, nil, nil
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, nil, noEOF(err)
+	}
+	var buf bytes.Buffer
+	if _, err = io.CopyN(&buf, r, int64(n)); err != nil {
+		return 0, 0, nil, noEOF(err)
+	}
+	return int(size64), crc, buf.Bytes(), nil
+}
+
+// appendUint32 дописывает v в buf в порядке big-endian.
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
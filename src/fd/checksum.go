@@ -0,0 +1,41 @@
+package fd
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// ErrChecksum возвращается (в составе ChecksumError), если контрольная сумма
+// распакованных данных не совпадает с записанной.
+var ErrChecksum = errors.New("fd: checksum mismatch")
+
+// ChecksumError сообщает, контрольная сумма какого блока не совпала.
+// errors.Is(err, ErrChecksum) возвращает true для ChecksumError.
+type ChecksumError struct {
+	Block int    // Номер блока, начиная с 0; -1 означает весь поток
+	Want  uint32 // Записанная контрольная сумма
+	Got   uint32 // Контрольная сумма распакованных данных
+}
+
+func (e *ChecksumError) Error() string {
+	if e.Block < 0 {
+		return fmt.Sprintf("%v: stream crc %08x, expected %08x", ErrChecksum, e.Got, e.Want)
+	}
+	return fmt.Sprintf("%v: block %d crc %08x, expected %08x", ErrChecksum, e.Block, e.Got, e.Want)
+}
+
+// Is позволяет сравнивать ChecksumError с ErrChecksum через errors.Is.
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksum
+}
+
+// checksum вычисляет контрольную сумму исходных данных блока.
+func checksum(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
+}
+
+// updateChecksum продолжает вычисление контрольной суммы всего потока.
+func updateChecksum(crc uint32, data []byte) uint32 {
+	return crc32.Update(crc, crc32.IEEETable, data)
+}
@@ -0,0 +1,10 @@
+// Package fd реализует формат .fd: данные разбиваются на блоки, каждый из которых
+// сжимается последовательностью BWTS -> MTF -> ZRLE -> Huffman
+// (этап RLE перед MTF необязателен и отмечается флагом FlagRLE).
+// Вместо кодирования Хаффмана можно выбрать арифметическое кодирование или rANS
+// (Options.Coder), они отмечаются флагами FlagArith и FlagANS. В режиме наибольшего сжатия
+// (CoderCM, флаг FlagCM) выход BWTS без MTF и ZRLE сжимается контекстным смешиванием.
+//
+// Writer и Reader работают с потоками, поэтому в памяти одновременно
+// находится не больше одного блока.
+package fd
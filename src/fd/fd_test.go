@@ -0,0 +1,317 @@
+package fd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/farit2000/compressor/src/arith"
+	"github.com/farit2000/compressor/src/huffman"
+	"github.com/farit2000/compressor/src/mtf"
+)
+
+// testData возвращает начало normMedium.txt на несколько блоков MinBlockSize и неполный блок.
+func testData(t *testing.T) []byte {
+	data, err := ioutil.ReadFile("../../testData/normMedium.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data[:3*MinBlockSize+1234]
+}
+
+// compress сжимает data в поток .fd с параметрами o.
+func compress(t *testing.T, data []byte, o *Options) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, o)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decompress распаковывает поток .fd в concurrency горутин.
+func decompress(stream []byte, concurrency int) ([]byte, error) {
+	return ioutil.ReadAll(NewReaderOptions(bytes.NewReader(stream), &Options{Concurrency: concurrency}))
+}
+
+// frame - смещения кадра блока в сжатом потоке.
+type frame struct {
+	crc     int // Контрольная сумма
+	payload int // Сжатые данные; у кадра конца потока равно концу потока
+}
+
+// frames возвращает кадры блоков stream, последний из них - кадр конца потока.
+func frames(t *testing.T, stream []byte) []frame {
+	br := bytes.NewReader(stream)
+	if _, err := ReadHeader(br); err != nil {
+		t.Fatal(err)
+	}
+	var fs []frame
+	for pos := len(stream) - br.Len(); ; {
+		size, n := binary.Uvarint(stream[pos:])
+		pos += n
+		f := frame{crc: pos}
+		pos += 4
+		if size == 0 {
+			fs = append(fs, frame{crc: f.crc, payload: pos})
+			return fs
+		}
+		m, n := binary.Uvarint(stream[pos:])
+		f.payload = pos + n
+		pos = f.payload + int(m)
+		fs = append(fs, f)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	for _, h := range []*Header{
+		{Flags: FlagBWTS | FlagMTF | FlagZRLE | FlagHuffman, Size: 12345, BlockSize: DefaultBlockSize,
+			Huffman: huffman.Options{WinSize: huffman.DefaultWinSize, Mode: huffman.MultiTable}},
+		{Flags: FlagBWTS | FlagRLE | FlagMTF | FlagZRLE | FlagHuffman, BlockSize: MinBlockSize,
+			Huffman: huffman.Options{WinSize: -1, Mode: huffman.Adaptive}},
+		{Flags: FlagBWTS | FlagMTF | FlagZRLE | FlagArith, Size: 1 << 40, BlockSize: MaxBlockSize,
+			Arith: arith.Options{Model: arith.Order0}},
+		{Flags: FlagBWTS | FlagMTF | FlagZRLE | FlagANS, BlockSize: DefaultBlockSize},
+		{Flags: FlagBWTS | FlagCM, Size: 1, BlockSize: DefaultBlockSize},
+	} {
+		var buf bytes.Buffer
+		if err := WriteHeader(&buf, h); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadHeader(&buf)
+		if err != nil {
+			t.Fatalf("flags %#x: %v", byte(h.Flags), err)
+		}
+		want := *h
+		want.Version = Version
+		if *got != want {
+			t.Errorf("flags %#x: read %+v, want %+v", byte(h.Flags), *got, want)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("flags %#x: %d bytes left after the header", byte(h.Flags), buf.Len())
+		}
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	var buf bytes.Buffer
+	WriteHeader(&buf, &Header{Flags: FlagBWTS | FlagMTF | FlagZRLE | FlagHuffman, BlockSize: DefaultBlockSize,
+		Huffman: huffman.Options{WinSize: huffman.DefaultWinSize, Mode: huffman.Static}})
+	valid := buf.Bytes()
+	// change возвращает копию valid, в которой байт i заменен на b.
+	change := func(i int, b byte) []byte {
+		h := append([]byte(nil), valid...)
+		h[i] = b
+		return h
+	}
+	for _, tt := range []struct {
+		name   string
+		header []byte
+		err    error
+	}{
+		{"empty", nil, ErrFormat},
+		{"magic", change(0, 'G'), ErrFormat},
+		{"gzip", []byte{0x1f, 0x8b, 8, 0, 0, 0}, ErrFormat},
+		{"short magic", valid[:3], ErrFormat},
+		{"old version", change(len(Magic), Version-1), ErrVersion},
+		{"new version", change(len(Magic), Version+1), ErrVersion},
+		{"unknown flags", change(len(Magic)+1, 0xff), ErrFormat},
+		{"two coders", change(len(Magic)+1, byte(FlagBWTS|FlagMTF|FlagZRLE|FlagHuffman|FlagArith)), ErrFormat},
+		{"zero runs with cm", change(len(Magic)+1, byte(FlagBWTS|FlagZRLE|FlagCM)), ErrFormat},
+		{"huffman mode", change(len(valid)-1, 0), ErrFormat},
+		{"no version", valid[:len(Magic)], ErrTruncated},
+		{"no huffman mode", valid[:len(valid)-1], ErrTruncated},
+	} {
+		if _, err := ReadHeader(bytes.NewReader(tt.header)); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := testData(t)
+	for _, tt := range []struct {
+		name  string
+		o     Options
+		flags Flags
+	}{
+		{"huffman multi", Options{}, FlagBWTS | FlagMTF | FlagZRLE | FlagHuffman},
+		{"huffman static", Options{Huffman: huffman.Options{Mode: huffman.Static}}, FlagBWTS | FlagMTF | FlagZRLE | FlagHuffman},
+		{"huffman adaptive", Options{Huffman: huffman.Options{Mode: huffman.Adaptive}}, FlagBWTS | FlagMTF | FlagZRLE | FlagHuffman},
+		{"huffman rle", Options{RLE: true}, FlagBWTS | FlagRLE | FlagMTF | FlagZRLE | FlagHuffman},
+		{"arith order0", Options{Coder: CoderArith, Arith: arith.Options{Model: arith.Order0}}, FlagBWTS | FlagMTF | FlagZRLE | FlagArith},
+		{"arith mtf", Options{Coder: CoderArith}, FlagBWTS | FlagMTF | FlagZRLE | FlagArith},
+		{"ans", Options{Coder: CoderANS}, FlagBWTS | FlagMTF | FlagZRLE | FlagANS},
+		{"cm", Options{Coder: CoderCM}, FlagBWTS | FlagCM},
+		{"cm rle", Options{Coder: CoderCM, RLE: true}, FlagBWTS | FlagRLE | FlagCM},
+	} {
+		// Сжатый поток не зависит от количества горутин, а блоки распаковываются по порядку
+		var first []byte
+		for _, concurrency := range []int{1, 3} {
+			o := tt.o
+			o.BlockSize, o.Size, o.Concurrency = MinBlockSize, uint64(len(data)), concurrency
+			stream := compress(t, data, &o)
+			if first == nil {
+				first = stream
+			} else if !bytes.Equal(stream, first) {
+				t.Errorf("%s: stream compressed with -j %d differs from -j 1", tt.name, concurrency)
+			}
+			r := NewReader(bytes.NewReader(stream))
+			if h, err := r.Header(); err != nil || h.Flags != tt.flags || h.Size != uint64(len(data)) {
+				t.Fatalf("%s: header %+v, %v; want flags %#x and size %d", tt.name, h, err, byte(tt.flags), len(data))
+			}
+			r.Close()
+			got, err := decompress(stream, concurrency)
+			if err != nil {
+				t.Fatalf("%s, -j %d: %v", tt.name, concurrency, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%s, -j %d: data mismatch", tt.name, concurrency)
+			}
+		}
+		info, err := Stat(bytes.NewReader(first))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(info.Blocks) != 4 || info.Size != uint64(len(data)) || info.CompressedSize != uint64(len(first)) {
+			t.Errorf("%s: Stat reports %d blocks, size %d, compressed size %d", tt.name, len(info.Blocks), info.Size, info.CompressedSize)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	stream := compress(t, nil, nil)
+	got, err := decompress(stream, 0)
+	if err != nil || len(got) != 0 {
+		t.Fatalf("empty stream: got %d bytes, %v", len(got), err)
+	}
+	if fs := frames(t, stream); len(fs) != 1 {
+		t.Fatalf("empty stream has %d frames, want only the end frame", len(fs))
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	data := testData(t)
+	stream := compress(t, data, &Options{BlockSize: MinBlockSize})
+	fs := frames(t, stream)
+	for i, f := range fs {
+		corrupt := append([]byte(nil), stream...)
+		corrupt[f.crc] ^= 1
+		for _, concurrency := range []int{1, 3} {
+			got, err := decompress(corrupt, concurrency)
+			var ce *ChecksumError
+			if !errors.As(err, &ce) || !errors.Is(err, ErrChecksum) {
+				t.Fatalf("crc of frame %d, -j %d: got %v, want *ChecksumError", i, concurrency, err)
+			}
+			want := i
+			if i == len(fs)-1 {
+				want = -1 // Контрольная сумма всего потока
+			}
+			if ce.Block != want {
+				t.Errorf("crc of frame %d, -j %d: error for block %d, want %d", i, concurrency, ce.Block, want)
+			}
+			// Блоки до поврежденного выдаются полностью, а при ошибке в кадре конца потока - все данные
+			n := i * MinBlockSize
+			if n > len(data) {
+				n = len(data)
+			}
+			if len(got) < n || !bytes.Equal(got[:n], data[:n]) {
+				t.Errorf("crc of frame %d, -j %d: %d bytes before the error, want at least %d", i, concurrency, len(got), n)
+			}
+		}
+	}
+}
+
+func TestBlockError(t *testing.T) {
+	data := testData(t)
+	stream := compress(t, data, &Options{BlockSize: MinBlockSize})
+	fs := frames(t, stream)
+	for _, tt := range []struct {
+		name  string
+		block int
+		patch []byte // Новое начало сжатых данных блока
+		err   error  // Исходная ошибка этапа распаковки
+	}{
+		{"block flags", 0, []byte{0xff}, nil},
+		{"empty alphabet range", 2, []byte{byte(FlagBWTS | FlagMTF | FlagZRLE | FlagHuffman), 0x80, 0, 0, 0}, mtf.ErrCorrupt},
+		{"alphabet bitmap", 3, []byte{byte(FlagBWTS | FlagMTF | FlagZRLE | FlagHuffman), 0xff, 0xff, 0, 0}, mtf.ErrCorrupt},
+	} {
+		corrupt := append([]byte(nil), stream...)
+		copy(corrupt[fs[tt.block].payload:], tt.patch)
+		_, err := decompress(corrupt, 2)
+		var be *BlockError
+		if !errors.As(err, &be) || be.Block != tt.block {
+			t.Fatalf("%s: got %v, want *BlockError for block %d", tt.name, err, tt.block)
+		}
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: errors.Is(%v, ErrCorrupt) is false", tt.name, err)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: errors.Is(%v, %v) is false", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	stream := compress(t, testData(t), &Options{BlockSize: MinBlockSize})
+	// Обрезка в каждом кадре: в размере, контрольной сумме и сжатых данных
+	cuts := []int{len(Magic), len(Magic) + 1, len(Magic) + 3}
+	for _, f := range frames(t, stream) {
+		cuts = append(cuts, f.crc-1, f.crc, f.crc+2, f.payload-1, f.payload+1, f.payload+1000)
+	}
+	for _, n := range cuts {
+		if n >= len(stream) {
+			continue
+		}
+		if _, err := decompress(stream[:n], 2); !errors.Is(err, ErrTruncated) {
+			t.Errorf("stream cut to %d of %d bytes: got %v, want ErrTruncated", n, len(stream), err)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	data := testData(t)[:1000]
+	for _, size := range []uint64{999, 1001} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, &Options{Size: size})
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err == nil || !strings.Contains(err.Error(), "header declares") {
+			t.Errorf("declared size %d, wrote %d: got %v, want a size mismatch", size, len(data), err)
+		}
+	}
+	// Размер в заголовке не совпадает с суммой размеров блоков
+	stream := compress(t, data, &Options{Size: uint64(len(data))})
+	sizePos := len(Magic) + 2
+	if n, k := binary.Uvarint(stream[sizePos:]); n != uint64(len(data)) || k != 2 {
+		t.Fatalf("header size %d in %d bytes", n, k)
+	}
+	stream[sizePos]++
+	if _, err := decompress(stream, 1); !errors.Is(err, ErrCorrupt) || !strings.Contains(err.Error(), "decompressed size") {
+		t.Fatalf("header size %d, data %d: got %v, want ErrCorrupt", len(data)+1, len(data), err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, nil)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte{1}); err != ErrClosed {
+		t.Errorf("Write after Close: got %v, want ErrClosed", err)
+	}
+	r := NewReader(bytes.NewReader(buf.Bytes()))
+	r.Close()
+	if _, err := r.Read(make([]byte, 1)); err != ErrClosed {
+		t.Errorf("Read after Close: got %v, want ErrClosed", err)
+	}
+}
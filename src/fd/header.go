@@ -0,0 +1,179 @@
+package fd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/farit2000/compressor/src/ans"
+	"github.com/farit2000/compressor/src/arith"
+	"github.com/farit2000/compressor/src/huffman"
+)
+
+const (
+	// Magic - сигнатура, с которой начинается каждый файл .fd
+	Magic = "FDCZ"
+	// Version - текущая версия формата контейнера
+	Version = 9
+)
+
+// Flags - набор этапов сжатия, которые были применены к данным.
+type Flags byte
+
+const (
+	FlagBWTS    Flags = 1 << iota // Применялось преобразование BWTS
+	FlagRLE                       // Применялось RLE кодирование (к блокам, которые оно уменьшает)
+	FlagMTF                       // Применялось MTF кодирование
+	FlagHuffman                   // Применялось кодирование Хаффмана
+	FlagZRLE                      // Серии нулей после MTF кодировались символами RUNA/RUNB
+	FlagArith                     // Применялось арифметическое кодирование (вместо кодирования Хаффмана)
+	FlagANS                       // Применялось кодирование rANS (вместо кодирования Хаффмана)
+	FlagCM                        // Применялось контекстное смешивание (режим наибольшего сжатия)
+
+	flagsKnown   = FlagBWTS | FlagRLE | FlagMTF | FlagHuffman | FlagZRLE | FlagArith | FlagANS | FlagCM
+	flagsEntropy = FlagHuffman | FlagArith | FlagANS | FlagCM // Энтропийные кодеры, применяется не больше одного
+)
+
+var (
+	// ErrFormat возвращается, если входные данные не являются файлом .fd.
+	ErrFormat = errors.New("fd: not an .fd file")
+	// ErrVersion возвращается, если версия формата не поддерживается.
+	ErrVersion = errors.New("fd: unsupported format version")
+)
+
+// Header - заголовок контейнера .fd, описывающий, как были сжаты данные.
+type Header struct {
+	Version   byte            // Версия формата
+	Flags     Flags           // Этапы сжатия, которые были применены
+	Size      uint64          // Размер исходных (несжатых) данных, 0 - если неизвестен
+	BlockSize int             // Наибольший размер блока исходных данных
+	Huffman   huffman.Options // Параметры кодирования Хаффмана, если установлен FlagHuffman
+	Arith     arith.Options   // Параметры арифметического кодирования, если установлен FlagArith
+	ANS       ans.Options     // Параметры rANS для сжатия; в заголовок не записываются, каждый блок хранит свои
+}
+
+// Has сообщает, был ли применен указанный этап.
+func (f Flags) Has(flag Flags) bool {
+	return f&flag != 0
+}
+
+// WriteHeader записывает заголовок h в w.
+// Поле Version игнорируется, всегда записывается текущая версия.
+// Параметры энтропийного кодера записываются только для кодера, выбранного флагами.
+func WriteHeader(w io.Writer, h *Header) error {
+	buf := make([]byte, 0, len(Magic)+3+3*binary.MaxVarintLen64)
+	buf = append(buf, Magic...)
+	buf = append(buf, Version, byte(h.Flags))
+	buf = appendUvarint(buf, h.Size)
+	buf = appendUvarint(buf, uint64(h.BlockSize))
+	if h.Flags.Has(FlagHuffman) {
+		buf = appendVarint(buf, int64(h.Huffman.WinSize))
+		buf = append(buf, byte(h.Huffman.Mode))
+	}
+	if h.Flags.Has(FlagArith) {
+		buf = append(buf, byte(h.Arith.Model))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadHeader читает и проверяет заголовок из r.
+// Возвращает ErrFormat, если сигнатура не совпадает, и ErrVersion, если версия неизвестна.
+func ReadHeader(r io.ByteReader) (*Header, error) {
+	for i := 0; i < len(Magic); i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrFormat
+			}
+			return nil, err
+		}
+		if b != Magic[i] {
+			return nil, ErrFormat
+		}
+	}
+	h := &Header{}
+	var err error
+	if h.Version, err = r.ReadByte(); err != nil {
+		return nil, noEOF(err)
+	}
+	if h.Version != Version {
+		return nil, fmt.Errorf("%w: %d", ErrVersion, h.Version)
+	}
+	flags, err := r.ReadByte()
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	h.Flags = Flags(flags)
+	if h.Flags&^flagsKnown != 0 {
+		return nil, fmt.Errorf("%w: unknown flags %#x", ErrFormat, flags)
+	}
+	if entropy := h.Flags & flagsEntropy; entropy&(entropy-1) != 0 {
+		return nil, fmt.Errorf("%w: more than one entropy coder (flags %#x)", ErrFormat, flags)
+	}
+	if h.Flags.Has(FlagZRLE) && h.Flags&flagsEntropy == 0 {
+		return nil, fmt.Errorf("%w: zero-run coding without entropy coding", ErrFormat)
+	}
+	if h.Flags.Has(FlagZRLE) && h.Flags.Has(FlagCM) {
+		return nil, fmt.Errorf("%w: zero-run coding with context mixing", ErrFormat)
+	}
+	if h.Size, err = binary.ReadUvarint(r); err != nil {
+		return nil, noEOF(err)
+	}
+	blockSize, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if blockSize < MinBlockSize || blockSize > MaxBlockSize {
+		return nil, fmt.Errorf("%w: invalid block size %d", ErrFormat, blockSize)
+	}
+	h.BlockSize = int(blockSize)
+	if h.Flags.Has(FlagHuffman) {
+		winSize, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		h.Huffman.WinSize = int(winSize)
+		mode, err := r.ReadByte()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		h.Huffman.Mode = huffman.Mode(mode)
+		if h.Huffman.Mode < huffman.Adaptive || h.Huffman.Mode > huffman.MultiTable {
+			return nil, fmt.Errorf("%w: unknown Huffman mode %d", ErrFormat, mode)
+		}
+	}
+	if h.Flags.Has(FlagArith) {
+		model, err := r.ReadByte()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		h.Arith.Model = arith.Model(model)
+		if h.Arith.Model != arith.Order0 && h.Arith.Model != arith.MTFRanks {
+			return nil, fmt.Errorf("%w: unknown arithmetic coding model %d", ErrFormat, model)
+		}
+	}
+	return h, nil
+}
+
+// appendUvarint дописывает v в buf в формате binary.PutUvarint.
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+// appendVarint дописывает v в buf в формате binary.PutVarint.
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+
+// noEOF заменяет io.EOF и io.ErrUnexpectedEOF на ErrTruncated:
+// конец данных посреди заголовка или кадра - это ошибка.
+func noEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package fd
+
+import (
+	"bufio"
+	"io"
+)
+
+// BlockInfo описывает один блок сжатого потока.
+type BlockInfo struct {
+	Size           int    // Исходный размер блока
+	CompressedSize int    // Размер сжатых данных блока
+	CRC            uint32 // Контрольная сумма исходных данных блока
+}
+
+// Info описывает сжатый поток без его распаковки.
+type Info struct {
+	Header         *Header
+	Blocks         []BlockInfo
+	Size           uint64 // Сумма исходных размеров блоков
+	CompressedSize uint64 // Размер всего сжатого потока, включая заголовок и кадры
+	CRC            uint32 // Контрольная сумма всего потока из кадра конца потока
+}
+
+// Ratio возвращает отношение размера сжатого потока к исходному размеру.
+func (i *Info) Ratio() float64 {
+	if i.Size == 0 {
+		return 0
+	}
+	return float64(i.CompressedSize) / float64(i.Size)
+}
+
+// Ratio возвращает отношение размера сжатых данных блока к исходному размеру.
+func (b *BlockInfo) Ratio() float64 {
+	if b.Size == 0 {
+		return 0
+	}
+	return float64(b.CompressedSize) / float64(b.Size)
+}
+
+// Stat читает заголовок и кадры блоков из r, не распаковывая данные.
+func Stat(r io.Reader) (*Info, error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+	h, err := ReadHeader(cr)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Header: h}
+	for {
+		size, crc, payload, err := readBlock(cr, h.BlockSize)
+		if err != nil {
+			return info, err
+		}
+		if size == 0 {
+			info.CRC = crc
+			break
+		}
+		info.Blocks = append(info.Blocks, BlockInfo{Size: size, CompressedSize: len(payload), CRC: crc})
+		info.Size += uint64(size)
+	}
+	info.CompressedSize = cr.n
+	return info, nil
+}
+
+// countingReader считает прочитанные байты.
+type countingReader struct {
+	r *bufio.Reader
+	n uint64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += uint64(n)
+	return
+}
+
+func (c *countingReader) ReadByte() (b byte, err error) {
+	if b, err = c.r.ReadByte(); err == nil {
+		c.n++
+	}
+	return
+}
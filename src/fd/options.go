@@ -0,0 +1,83 @@
+package fd
+
+import (
+	"runtime"
+
+	"github.com/farit2000/compressor/src/ans"
+	"github.com/farit2000/compressor/src/arith"
+	"github.com/farit2000/compressor/src/huffman"
+)
+
+// Coder - энтропийный кодер последнего этапа сжатия.
+type Coder byte
+
+const (
+	CoderHuffman Coder = iota + 1 // Кодирование Хаффмана с параметрами Options.Huffman
+	CoderArith                    // Арифметическое кодирование с параметрами Options.Arith
+	CoderANS                      // Кодирование rANS с параметрами Options.ANS
+	CoderCM                       // Контекстное смешивание вместо MTF, ZRLE и энтропийного кодирования
+)
+
+type Options struct {
+	// BlockSize указывает размер блока, на которые разбиваются входные данные.
+	// 0 означает использование размера по умолчанию (DefaultBlockSize).
+	// Допустимые значения лежат в пределах [MinBlockSize, MaxBlockSize].
+	BlockSize int
+	// Size - размер исходных данных, если он известен заранее.
+	// Записывается в заголовок и проверяется при закрытии Writer и при чтении.
+	// 0 означает, что размер неизвестен.
+	Size uint64
+	// Concurrency - количество блоков, которые сжимаются (или распаковываются) параллельно.
+	// 0 означает использование runtime.GOMAXPROCS(0). В заголовок не записывается.
+	Concurrency int
+	// Huffman - параметры кодирования Хаффмана, записываются в заголовок.
+	// Нулевое значение Huffman.Mode означает huffman.MultiTable: он быстрее адаптивного кода
+	// и на больших блоках сжимает лучше. huffman.Static еще быстрее, но сжимает хуже.
+	Huffman huffman.Options
+	// Coder - энтропийный кодер последнего этапа. 0 означает CoderHuffman.
+	// Арифметический кодер сжимает лучше, но медленнее режима huffman.MultiTable.
+	// rANS со статическими частотами распаковывает быстрее арифметического кодера,
+	// а сжимает примерно как huffman.Static. CoderCM сжимает лучше всех, но в несколько раз
+	// медленнее остальных и занимает около 20 МБ памяти на каждый параллельно сжимаемый блок.
+	Coder Coder
+	// Arith - параметры арифметического кодирования, модель записывается в заголовок.
+	// Нулевое значение Arith.Model означает arith.MTFRanks.
+	Arith arith.Options
+	// ANS - параметры кодирования rANS. Они хранятся в каждом блоке,
+	// поэтому в заголовок не записываются. Нулевые поля означают значения по умолчанию пакета ans.
+	ANS ans.Options
+	// RLE включает этап RLE между BWTS и MTF (или контекстным смешиванием). Вместе с ZRLE
+	// он обычно ухудшает сжатие: серии нулей после MTF ZRLE кодирует короче. С CoderCM на данных
+	// с длинными сериями RLE сокращает работу контекстной модели и может улучшить сжатие.
+	// Блоки, которые RLE не уменьшает, записываются без него.
+	RLE bool
+}
+
+// checkOptions возвращает новые параметры, в которых "отсутствующие" поля (с нулевым значением) устанавливаются в значения по умолчанию.
+// Переданные параметры не изменяются.
+// Разрешено передавать nil, который рассматривается как нулевое значение Options.
+func checkOptions(o *Options) *Options {
+	o2 := new(Options)
+	if o != nil {
+		*o2 = *o
+	}
+	if o2.BlockSize == 0 {
+		o2.BlockSize = DefaultBlockSize
+	}
+	if o2.Concurrency <= 0 {
+		o2.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if o2.Huffman.WinSize == 0 {
+		o2.Huffman.WinSize = huffman.DefaultWinSize
+	}
+	if o2.Huffman.Mode == 0 {
+		o2.Huffman.Mode = huffman.MultiTable
+	}
+	if o2.Coder == 0 {
+		o2.Coder = CoderHuffman
+	}
+	if o2.Arith.Model == 0 {
+		o2.Arith.Model = arith.MTFRanks
+	}
+	return o2
+}
@@ -0,0 +1,73 @@
+package fd
+
+// job - задание на сжатие или распаковку одного блока.
+type job struct {
+	index int           // Номер блока в потоке
+	in    []byte        // Входные данные блока
+	size  int           // Исходный размер блока (используется при распаковке)
+	crc   uint32        // Контрольная сумма исходных данных блока
+	out   []byte        // Результат
+	err   error         // Ошибка обработки
+	done  chan struct{} // Закрывается, когда задание выполнено
+}
+
+func newJob(index int, in []byte, size int, crc uint32) *job {
+	return &job{index: index, in: in, size: size, crc: crc, done: make(chan struct{})}
+}
+
+// pool - пул горутин, обрабатывающих блоки параллельно.
+// Каждая горутина владеет собственным кодером (буферы BWTS и DivSufSort не разделяются),
+// а результаты выдаются строго в порядке отправки заданий.
+// Методы pool вызываются из одной горутины.
+type pool struct {
+	jobs    chan *job
+	pending []*job // Отправленные, но еще не выданные задания, в порядке отправки
+	size    int    // Количество горутин и наибольшее число заданий в работе
+	stopped bool
+}
+
+// newPool запускает n горутин, i-я из которых обрабатывает задания функцией workers[i].
+func newPool(workers []func(*job)) *pool {
+	p := &pool{jobs: make(chan *job, len(workers)), size: len(workers)}
+	for _, work := range workers {
+		go func(work func(*job)) {
+			for j := range p.jobs {
+				work(j)
+				close(j.done)
+			}
+		}(work)
+	}
+	return p
+}
+
+// full сообщает, что в работе максимальное число заданий и перед отправкой нового
+// нужно забрать результат через next.
+func (p *pool) full() bool {
+	return len(p.pending) >= p.size
+}
+
+// submit отправляет задание в работу.
+func (p *pool) submit(j *job) {
+	p.pending = append(p.pending, j)
+	p.jobs <- j
+}
+
+// next дожидается и возвращает самое раннее отправленное задание, nil - если заданий нет.
+func (p *pool) next() *job {
+	if len(p.pending) == 0 {
+		return nil
+	}
+	j := p.pending[0]
+	<-j.done
+	p.pending[0] = nil
+	p.pending = p.pending[1:]
+	return j
+}
+
+// stop завершает горутины пула после выполнения уже отправленных заданий.
+func (p *pool) stop() {
+	if !p.stopped {
+		p.stopped = true
+		close(p.jobs)
+	}
+}
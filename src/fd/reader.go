@@ -0,0 +1,148 @@
+package fd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Reader - это реализация считывателя формата .fd.
+// Блоки распаковываются параллельно в Options.Concurrency горутинах и выдаются по порядку.
+type Reader struct {
+	in          byteReader
+	header      *Header
+	concurrency int
+	pool        *pool  // Пул горутин, создается после чтения заголовка
+	block       []byte // Непрочитанная часть текущего распакованного блока
+	blocks      int    // Количество прочитанных блоков
+	total       uint64 // Количество распакованных байтов
+	crc         uint32 // Контрольная сумма распакованных данных
+	end         bool   // Сообщает, прочитан ли кадр конца потока
+	endCRC      uint32 // Контрольная сумма всего потока из кадра конца потока
+	readErr     error  // Ошибка чтения входа, возвращается после выдачи уже прочитанных блоков
+	err         error  // Первая возникшая ошибка (io.EOF после конца потока)
+}
+
+// NewReader возвращает новый Reader, используя указанный io.Reader в качестве ввода (источника),
+// с параметрами по умолчанию.
+// Все параметры сжатия читаются из заголовка потока.
+// Если in не реализует io.ByteReader, Reader может прочитать из него больше данных, чем нужно.
+func NewReader(in io.Reader) *Reader {
+	return NewReaderOptions(in, nil)
+}
+
+// NewReaderOptions возвращает новый Reader, используя указанный io.Reader в качестве ввода (источника),
+// с указанными опциями. Из опций используется только Concurrency,
+// остальные параметры читаются из заголовка потока.
+func NewReaderOptions(in io.Reader, o *Options) *Reader {
+	o = checkOptions(o)
+	bin, ok := in.(byteReader)
+	if !ok {
+		bin = bufio.NewReader(in)
+	}
+	return &Reader{in: bin, concurrency: o.Concurrency}
+}
+
+// Header возвращает заголовок потока, читая его при необходимости.
+func (r *Reader) Header() (*Header, error) {
+	if r.header == nil && r.err == nil {
+		r.header, r.err = ReadHeader(r.in)
+		if r.err == nil {
+			r.err = r.startPool()
+		}
+	}
+	if r.header == nil {
+		return nil, r.err
+	}
+	return r.header, nil
+}
+
+// startPool запускает горутины распаковки, у каждой свой blockDecoder.
+func (r *Reader) startPool() error {
+	workers := make([]func(*job), r.concurrency)
+	for i := range workers {
+		dec, err := newBlockDecoder(r.header)
+		if err != nil {
+			return err
+		}
+		workers[i] = func(j *job) {
+			var err error
+			if j.out, err = dec.decode(j.in, j.size); err != nil {
+				j.err = &BlockError{Block: j.index, Err: err}
+				return
+			}
+			if crc := checksum(j.out); crc != j.crc {
+				j.err = &ChecksumError{Block: j.index, Want: j.crc, Got: crc}
+			}
+		}
+	}
+	r.pool = newPool(workers)
+	return nil
+}
+
+// Read распаковывает до len(p) байтов из источника.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	if _, err = r.Header(); err != nil {
+		return 0, err
+	}
+	for len(r.block) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.err = r.nextBlock(); r.err != nil {
+			r.pool.stop()
+		}
+	}
+	n = copy(p, r.block)
+	r.block = r.block[n:]
+	return n, nil
+}
+
+// nextBlock дочитывает блоки, пока в работе не окажется максимальное их число,
+// и забирает распакованный самый ранний из них.
+// В конце потока проверяет общий размер и контрольную сумму и возвращает io.EOF.
+func (r *Reader) nextBlock() error {
+	for !r.end && r.readErr == nil && !r.pool.full() {
+		size, crc, payload, err := readBlock(r.in, r.header.BlockSize)
+		if err != nil {
+			r.readErr = err
+		} else if size == 0 {
+			r.end, r.endCRC = true, crc
+		} else {
+			r.pool.submit(newJob(r.blocks, payload, size, crc))
+			r.blocks++
+		}
+	}
+	j := r.pool.next()
+	if j == nil {
+		if r.readErr != nil {
+			return r.readErr
+		}
+		if r.header.Size != 0 && r.total != r.header.Size {
+			return fmt.Errorf("%w: decompressed size is %d, expected %d", ErrCorrupt, r.total, r.header.Size)
+		}
+		if r.crc != r.endCRC {
+			return &ChecksumError{Block: -1, Want: r.endCRC, Got: r.crc}
+		}
+		return io.EOF
+	}
+	if j.err != nil {
+		return j.err
+	}
+	r.block = j.out
+	r.total += uint64(j.size)
+	r.crc = updateChecksum(r.crc, j.out)
+	return nil
+}
+
+// Close завершает горутины распаковки. Базовый io.Reader не закрывается.
+// Вызывать Close нужно, только если поток не дочитан до конца или до ошибки.
+func (r *Reader) Close() error {
+	if r.pool != nil {
+		r.pool.stop()
+	}
+	if r.err == nil {
+		r.err = ErrClosed
+	}
+	return nil
+}
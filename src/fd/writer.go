@@ -0,0 +1,184 @@
+package fd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrClosed возвращается при использовании закрытого Writer или Reader.
+var ErrClosed = errors.New("fd: stream is closed")
+
+// Writer - это реализация модуля записи формата .fd.
+// Блоки сжимаются параллельно в Options.Concurrency горутинах и записываются по порядку.
+// Должен быть закрыт для правильной отправки последнего блока и конца потока,
+// а также для завершения горутин.
+type Writer struct {
+	out         io.Writer
+	header      *Header
+	concurrency int
+	pool        *pool    // Пул горутин, создается при первом заполненном блоке
+	block       []byte   // Буфер текущего блока
+	free        [][]byte // Буферы блоков, которые можно использовать повторно
+	blocks      int      // Количество отправленных на сжатие блоков
+	total       uint64   // Количество байтов, записанных в выходной поток в виде блоков
+	crc         uint32   // Контрольная сумма записанных данных
+	wrote       bool     // Сообщает, записан ли заголовок
+	err         error    // Первая возникшая ошибка, возвращается всеми последующими вызовами
+}
+
+// NewWriter возвращает новый Writer, используя указанный io.Writer в качестве вывода,
+// с указанными опциями (nil означает параметры по умолчанию).
+// Ошибка в опциях будет возвращена первым вызовом Write или Close.
+func NewWriter(out io.Writer, o *Options) *Writer {
+	o = checkOptions(o)
+	w := &Writer{out: out, concurrency: o.Concurrency}
+	w.header = &Header{
+		Flags:     FlagBWTS | FlagMTF | FlagZRLE,
+		Size:      o.Size,
+		BlockSize: o.BlockSize,
+	}
+	switch o.Coder {
+	case CoderHuffman:
+		w.header.Flags |= FlagHuffman
+		w.header.Huffman = o.Huffman
+	case CoderArith:
+		w.header.Flags |= FlagArith
+		w.header.Arith = o.Arith
+	case CoderANS:
+		w.header.Flags |= FlagANS
+		w.header.ANS = o.ANS
+	case CoderCM:
+		// Контекстная модель сама учитывает серии и локальную статистику выхода BWTS
+		w.header.Flags = FlagBWTS | FlagCM
+	default:
+		w.err = fmt.Errorf("fd: unknown entropy coder %d", o.Coder)
+		return w
+	}
+	if o.RLE {
+		w.header.Flags |= FlagRLE
+	}
+	if w.err = CheckBlockSize(o.BlockSize); w.err != nil {
+		return w
+	}
+	w.block = make([]byte, 0, o.BlockSize)
+	return w
+}
+
+// Write записывает сжатую форму p в базовый io.Writer.
+// Данные сжимаются и записываются по мере заполнения блоков.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	for len(p) > 0 {
+		k := copy(w.block[len(w.block):cap(w.block)], p)
+		w.block = w.block[:len(w.block)+k]
+		p = p[k:]
+		n += k
+		if len(w.block) == cap(w.block) {
+			if err = w.flushBlock(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flushBlock отправляет накопленный блок на сжатие, записав перед этим заголовок, если нужно.
+// Если в работе уже максимальное число блоков, сначала записывает самый ранний из них.
+func (w *Writer) flushBlock() error {
+	if !w.wrote {
+		if w.err = WriteHeader(w.out, w.header); w.err != nil {
+			return w.err
+		}
+		w.wrote = true
+	}
+	if len(w.block) == 0 {
+		return nil
+	}
+	if w.pool == nil {
+		if w.err = w.startPool(); w.err != nil {
+			return w.err
+		}
+	}
+	if w.pool.full() {
+		if err := w.writeNext(); err != nil {
+			return err
+		}
+	}
+	w.pool.submit(newJob(w.blocks, w.block, len(w.block), 0))
+	w.blocks++
+	if n := len(w.free); n > 0 {
+		w.block, w.free = w.free[n-1], w.free[:n-1]
+	} else {
+		w.block = make([]byte, 0, w.header.BlockSize)
+	}
+	return nil
+}
+
+// startPool запускает горутины сжатия, у каждой свой blockEncoder.
+func (w *Writer) startPool() error {
+	workers := make([]func(*job), w.concurrency)
+	for i := range workers {
+		enc, err := newBlockEncoder(w.header)
+		if err != nil {
+			return err
+		}
+		workers[i] = func(j *job) {
+			j.crc = checksum(j.in)
+			j.out, j.err = enc.encode(j.in)
+		}
+	}
+	w.pool = newPool(workers)
+	return nil
+}
+
+// writeNext дожидается самого раннего блока в работе и записывает его.
+func (w *Writer) writeNext() error {
+	j := w.pool.next()
+	err := j.err
+	if err == nil {
+		err = writeBlock(w.out, len(j.in), j.crc, j.out)
+	}
+	if err != nil {
+		w.err = err
+		w.pool.stop()
+		return err
+	}
+	w.total += uint64(len(j.in))
+	w.crc = updateChecksum(w.crc, j.in)
+	w.free = append(w.free, j.in[:0])
+	return nil
+}
+
+// Close сжимает оставшиеся данные и записывает конец потока.
+// Базовый io.Writer не закрывается.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		if w.err == ErrClosed {
+			return nil
+		}
+		return w.err
+	}
+	if err := w.flushBlock(); err != nil {
+		return err
+	}
+	if w.pool != nil {
+		for len(w.pool.pending) > 0 {
+			if err := w.writeNext(); err != nil {
+				return err
+			}
+		}
+		w.pool.stop()
+	}
+	if w.header.Size != 0 && w.total != w.header.Size {
+		w.err = fmt.Errorf("fd: wrote %d bytes, header declares %d", w.total, w.header.Size)
+		return w.err
+	}
+	if w.err = writeEnd(w.out, w.crc); w.err != nil {
+		return w.err
+	}
+	w.err = ErrClosed
+	return nil
+}
@@ -0,0 +1,365 @@
+package huffman
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/farit2000/compressor/src/bitio"
+)
+
+// CodeLengths строит код Хаффмана по частотам символов и возвращает длины кодов:
+// lengths[v] - длина кода символа v, 0 - если символ не встречается (counts[v] == 0).
+// Длины не превышают maxLen: если дерево Хаффмана оказывается глубже, оптимальный код
+// с ограниченной длиной строится алгоритмом package-merge.
+// maxLen должно быть не больше MaxCodeLen, а 1<<maxLen - не меньше числа встречающихся символов.
+// Если встречается только один символ, его код имеет длину 1.
+func CodeLengths(counts []int, maxLen uint8) []uint8 {
+	lengths := make([]uint8, len(counts))
+	var leaves []*Node
+	for v, c := range counts {
+		if c > 0 {
+			leaves = append(leaves, &Node{Value: ValueType(v), Count: c})
+		}
+	}
+	switch len(leaves) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[leaves[0].Value] = 1
+		return lengths
+	}
+	// Устойчивая сортировка сохраняет порядок значений при равных частотах,
+	// поэтому одинаковые частоты всегда дают одинаковые длины.
+	sort.Stable(SortNodes(leaves))
+	nodes := append([]*Node(nil), leaves...)
+	BuildSorted(nodes)
+	tooLong := false
+	for _, n := range leaves {
+		_, bits := n.Code()
+		lengths[n.Value] = bits
+		tooLong = tooLong || bits > maxLen
+	}
+	if tooLong {
+		packageMerge(leaves, maxLen, lengths)
+	}
+	return lengths
+}
+
+// pmItem - элемент списка алгоритма package-merge: лист или пакет из двух элементов.
+type pmItem struct {
+	count       int
+	leaf        *Node   // Лист, nil для пакета
+	left, right *pmItem // Элементы пакета
+}
+
+// packageMerge записывает в lengths оптимальные длины кодов, не превышающие maxLen,
+// для листьев leaves, отсортированных по Node.Count.
+func packageMerge(leaves []*Node, maxLen uint8, lengths []uint8) {
+	items := make([]*pmItem, len(leaves))
+	for i, n := range leaves {
+		items[i] = &pmItem{count: n.Count, leaf: n}
+	}
+	list := items
+	for level := uint8(1); level < maxLen; level++ {
+		// Объединяем соседние элементы в пакеты и сливаем пакеты с листьями по частоте.
+		packages := make([]*pmItem, 0, len(list)/2)
+		for i := 0; i+1 < len(list); i += 2 {
+			packages = append(packages, &pmItem{count: list[i].count + list[i+1].count, left: list[i], right: list[i+1]})
+		}
+		merged := make([]*pmItem, 0, len(items)+len(packages))
+		i, j := 0, 0
+		for i < len(items) || j < len(packages) {
+			if j == len(packages) || i < len(items) && items[i].count <= packages[j].count {
+				merged = append(merged, items[i])
+				i++
+			} else {
+				merged = append(merged, packages[j])
+				j++
+			}
+		}
+		list = merged
+	}
+	// Длина кода символа - количество вхождений его листа в первые 2n-2 элемента.
+	for _, n := range leaves {
+		lengths[n.Value] = 0
+	}
+	var count func(it *pmItem)
+	count = func(it *pmItem) {
+		if it.leaf != nil {
+			lengths[it.leaf.Value]++
+			return
+		}
+		count(it.left)
+		count(it.right)
+	}
+	for _, it := range list[:2*len(leaves)-2] {
+		count(it)
+	}
+}
+
+// CanonicalCodes возвращает канонические коды для длин кодов lengths:
+// коды назначаются по возрастанию длины, а при равной длине - по возрастанию значения символа.
+// Символы с нулевой длиной получают код 0.
+func CanonicalCodes(lengths []uint8) []uint64 {
+	var count [MaxCodeLen + 1]uint64
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [MaxCodeLen + 1]uint64
+	code := uint64(0)
+	for l := 1; l <= MaxCodeLen; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	codes := make([]uint64, len(lengths))
+	for v, l := range lengths {
+		if l > 0 {
+			codes[v] = next[l]
+			next[l]++
+		}
+	}
+	return codes
+}
+
+const (
+	// MaxCodeLen - наибольшая длина кода в режимах Static и MultiTable.
+	MaxCodeLen = 32
+	// DefaultMaxCodeLen - ограничение длины кода по умолчанию.
+	DefaultMaxCodeLen = 20
+)
+
+// writeLengths записывает длины кодов: количество используемых символов (гамма-код),
+// а для каждого из них - количество пропущенных перед ним неиспользуемых значений
+// (Exp-Golomb порядка 0) и разность с длиной предыдущего используемого символа
+// (как в bzip2: "10" - увеличить на 1, "11" - уменьшить на 1, "0" - конец).
+// Размер описания зависит от количества используемых символов, а не от размера алфавита.
+func writeLengths(bw *bitio.Writer, lengths []uint8) error {
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	bw.TryWriteGamma(uint64(used))
+	cur, gap := uint8(0), 0
+	for _, l := range lengths {
+		if l == 0 {
+			gap++
+			continue
+		}
+		bw.TryWriteExpGolomb(uint64(gap), 0)
+		gap = 0
+		for ; cur < l; cur++ {
+			bw.TryWriteBits(2, 2)
+		}
+		for ; cur > l; cur-- {
+			bw.TryWriteBits(3, 2)
+		}
+		bw.TryWriteBool(false)
+	}
+	return bw.TryError
+}
+
+// readLengths читает n длин кодов, записанных writeLengths.
+// Возвращает io.EOF, если поток пуст.
+func readLengths(br *bitio.Reader, n int) ([]uint8, error) {
+	used, err := br.ReadGamma()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, codeError(err)
+	}
+	if used > uint64(n) {
+		return nil, fmt.Errorf("%w: %d code lengths for the alphabet of %d symbols", ErrCorrupt, used, n)
+	}
+	lengths := make([]uint8, n)
+	v, cur := 0, 0
+	for i := uint64(0); i < used; i++ {
+		gap, err := br.ReadExpGolomb(0)
+		if err != nil {
+			return nil, codeError(err)
+		}
+		if gap >= uint64(n-v) {
+			return nil, fmt.Errorf("%w: code length for a symbol outside the alphabet of %d symbols", ErrCorrupt, n)
+		}
+		v += int(gap)
+		for {
+			more, err := br.ReadBool()
+			if err != nil {
+				return nil, truncated(err)
+			}
+			if !more {
+				break
+			}
+			down, err := br.ReadBool()
+			if err != nil {
+				return nil, truncated(err)
+			}
+			if down {
+				cur--
+			} else {
+				cur++
+			}
+			if cur < 1 || cur > MaxCodeLen {
+				return nil, fmt.Errorf("%w: invalid code length %d", ErrCorrupt, cur)
+			}
+		}
+		if cur < 1 {
+			return nil, fmt.Errorf("%w: invalid code length %d", ErrCorrupt, cur)
+		}
+		lengths[v] = uint8(cur)
+		v++
+	}
+	return lengths, nil
+}
+
+// codeError заменяет ошибки чтения целочисленных кодов bitio на ErrTruncated и ErrCorrupt.
+func codeError(err error) error {
+	if errors.Is(err, bitio.ErrInvalidCode) {
+		return fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return truncated(err)
+}
+
+// lookupBits - наибольшее количество битов, по которым декодер определяет символ одним обращением
+// к первичной таблице. Более длинные коды дочитываются по вторичным таблицам.
+const lookupBits = 10
+
+// lookupEntry - запись таблицы декодирования.
+type lookupEntry struct {
+	value   ValueType // Символ или смещение вторичной таблицы
+	length  uint8     // Полная длина кода символа; 0 - запись указывает на вторичную таблицу
+	subBits uint8     // Количество битов индекса вторичной таблицы; 0 вместе с length == 0 - неверный код
+}
+
+// canonicalDecoder декодирует канонический код Хаффмана по таблицам:
+// первичная таблица индексируется следующими tableBits битами потока,
+// а коды длиннее tableBits дочитываются по вторичным таблицам, которые хранятся
+// в том же срезе после первичной.
+type canonicalDecoder struct {
+	table     []lookupEntry
+	tableBits uint8
+	maxLen    uint8 // Наибольшая длина кода
+}
+
+// newCanonicalDecoder создает декодер для длин кодов lengths.
+// Возвращает ErrCorrupt, если длины не образуют полный префиксный код.
+func newCanonicalDecoder(lengths []uint8) (*canonicalDecoder, error) {
+	var count [MaxCodeLen + 1]uint64
+	used, maxLen := 0, uint8(0)
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+			used++
+			if l > maxLen {
+				maxLen = l
+			}
+		}
+	}
+	if used == 0 {
+		return nil, fmt.Errorf("%w: no code lengths", ErrCorrupt)
+	}
+	// Проверяем неравенство Крафта: код должен быть полным (или состоять из одного символа).
+	left := uint64(1)
+	for l := 1; l <= int(maxLen); l++ {
+		left <<= 1
+		if count[l] > left {
+			return nil, fmt.Errorf("%w: code lengths are oversubscribed", ErrCorrupt)
+		}
+		left -= count[l]
+	}
+	if left != 0 && used > 1 {
+		return nil, fmt.Errorf("%w: code lengths are incomplete", ErrCorrupt)
+	}
+
+	d := &canonicalDecoder{tableBits: maxLen, maxLen: maxLen}
+	if d.tableBits > lookupBits {
+		d.tableBits = lookupBits
+	}
+	k := d.tableBits
+	codes := CanonicalCodes(lengths)
+	// Размер вторичной таблицы для каждого префикса из k битов - по самому длинному коду с этим префиксом.
+	subBits := make(map[uint64]uint8)
+	for v, l := range lengths {
+		if l > k {
+			prefix := codes[v] >> (l - k)
+			if l-k > subBits[prefix] {
+				subBits[prefix] = l - k
+			}
+		}
+	}
+	size := 1 << k
+	for _, b := range subBits {
+		size += 1 << b
+	}
+	d.table = make([]lookupEntry, 1<<k, size)
+	for prefix := uint64(0); prefix < 1<<k; prefix++ {
+		if b, ok := subBits[prefix]; ok {
+			d.table[prefix] = lookupEntry{value: ValueType(len(d.table)), subBits: b}
+			d.table = d.table[:len(d.table)+1<<b]
+		}
+	}
+	for v, l := range lengths {
+		switch {
+		case l == 0:
+		case l <= k:
+			first := codes[v] << (k - l)
+			for i := first; i < first+1<<(k-l); i++ {
+				d.table[i] = lookupEntry{value: ValueType(v), length: l}
+			}
+		default:
+			sub := d.table[codes[v]>>(l-k)]
+			rest := l - k // Биты кода после префикса
+			first := uint64(sub.value) + (codes[v]&(1<<rest-1))<<(sub.subBits-rest)
+			for i := first; i < first+1<<(sub.subBits-rest); i++ {
+				d.table[i] = lookupEntry{value: ValueType(v), length: l}
+			}
+		}
+	}
+	return d, nil
+}
+
+// decode читает один код и возвращает его символ.
+// Ошибки PeekBits в конце потока не проверяются: недостающие биты равны 0,
+// а если код не поместился в поток, ошибку вернет SkipBits.
+func (d *canonicalDecoder) decode(br *bitio.Reader) (ValueType, error) {
+	u, _ := br.PeekBits(d.tableBits)
+	e := d.table[u]
+	if e.length == 0 {
+		if e.subBits == 0 {
+			return 0, fmt.Errorf("%w: invalid code", ErrCorrupt)
+		}
+		u, _ = br.PeekBits(d.tableBits + e.subBits)
+		e = d.table[int(e.value)+int(u&(1<<e.subBits-1))]
+	}
+	if err := br.SkipBits(e.length); err != nil {
+		return 0, truncated(err)
+	}
+	return e.value, nil
+}
+
+// maxLength возвращает наибольшую из длин кодов lengths.
+func maxLength(lengths []uint8) (maxLen uint8) {
+	for _, l := range lengths {
+		if l > maxLen {
+			maxLen = l
+		}
+	}
+	return
+}
+
+// flushPadding возвращает количество нулевых байтов, которые Flush дописывает после признака
+// продолжения полустатического кода и skipped битов выравнивания. Декодер просматривает
+// до maxLen битов от начала кода, и эти биты должны помещаться в уже записанные данные,
+// иначе читатель потока, который еще пишется, ждал бы следующей порции данных.
+func flushPadding(maxLen, skipped uint8) int {
+	tail := 1 + int(skipped)
+	if tail >= int(maxLen) {
+		return 0
+	}
+	return (int(maxLen) - tail + 7) / 8
+}
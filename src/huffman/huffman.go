@@ -1,3 +1,12 @@
+// Package huffman реализует кодирование Хаффмана символов произвольного алфавита:
+// значения ValueType из [0, Options.AlphabetSize). По умолчанию алфавит - байты,
+// и Writer/Reader работают как io.Writer/io.Reader, а символы больших алфавитов
+// (например, длины серий RLE, номера MTF с escape-символами или 16-битные слова)
+// записываются через Writer.WriteSymbol и читаются через Reader.ReadSymbol.
+// Размер алфавита не записывается в поток: Reader должен быть создан с тем же AlphabetSize.
+//
+// Код строится адаптивно по скользящему окну (Adaptive) или полустатически по всем
+// символам потока (Static, MultiTable), см. Mode.
 package huffman
 
 import (
@@ -14,6 +23,7 @@ type Node struct {
 	Right  *Node     // Необязательный правый узел
 	Count  int       // Относительная частота
 	Value  ValueType // Необязательное значение, устанавливается, если это лист
+	index  int       // Позиция узла в symbols.order (адаптивный код)
 }
 
 // Код возвращает код Хаффмана узла.
@@ -0,0 +1,438 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/farit2000/compressor/src/bitio"
+)
+
+// Частоты, растущие как числа Фибоначчи, дают коды длиной до количества символов.
+func fibonacciCounts(n int) []int {
+	counts := make([]int, n)
+	a, b := 1, 1
+	for i := range counts {
+		counts[i] = a
+		a, b = b, a+b
+	}
+	return counts
+}
+
+func TestCanonicalDecoderLongCodes(t *testing.T) {
+	counts := fibonacciCounts(24)
+	lengths := CodeLengths(counts, 18)
+	if maxLen := maxLength(lengths); maxLen != 18 {
+		t.Fatalf("longest code is %d bits, want 18", maxLen)
+	}
+	codes := CanonicalCodes(lengths)
+	d, err := newCanonicalDecoder(lengths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.tableBits != lookupBits || len(d.table) == 1<<lookupBits {
+		t.Fatalf("decoder has no secondary tables: tableBits %d, table size %d", d.tableBits, len(d.table))
+	}
+	// Все символы, в том числе самые длинные коды, вперемешку
+	rng := rand.New(rand.NewSource(1))
+	values := make([]ValueType, 10000)
+	for i := range values {
+		values[i] = ValueType(rng.Intn(len(counts)))
+	}
+	var buf bytes.Buffer
+	bw := bitio.NewWriter(&buf)
+	for _, v := range values {
+		bw.TryWriteBits(codes[v], lengths[v])
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	br := bitio.NewReader(bytes.NewReader(buf.Bytes()))
+	for i, want := range values {
+		got, err := d.decode(br)
+		if err != nil {
+			t.Fatalf("symbol %d: %v", i, err)
+		}
+		if got != want {
+			t.Fatalf("symbol %d: got %d, want %d (code length %d)", i, got, want, lengths[want])
+		}
+	}
+}
+
+func TestCanonicalDecoderCorrupt(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		lengths []uint8
+	}{
+		{"empty", []uint8{0, 0, 0}},
+		{"oversubscribed", []uint8{1, 1, 1}},
+		{"oversubscribed long", []uint8{2, 2, 2, 2, 3}},
+		{"incomplete", []uint8{1, 2, 0}},
+		{"incomplete long", []uint8{1, 2, 3, 4, 12}},
+	} {
+		if _, err := newCanonicalDecoder(tc.lengths); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s %v: got error %v, want ErrCorrupt", tc.name, tc.lengths, err)
+		}
+	}
+	// Код из одного символа допустим
+	if _, err := newCanonicalDecoder([]uint8{0, 1}); err != nil {
+		t.Errorf("single symbol: %v", err)
+	}
+}
+
+// checkSymbols проверяет инварианты адаптивного дерева: order упорядочен по невозрастанию
+// частот, братья занимают позиции 2k-1 и 2k, частота узла равна сумме частот потомков,
+// а частота листа - количеству вхождений символа в окно window.
+func checkSymbols(t *testing.T, s *symbols, window []ValueType) {
+	t.Helper()
+	if s.order[0] != s.root || s.root.Parent != nil {
+		t.Fatal("order[0] is not the root")
+	}
+	for i, n := range s.order {
+		if n.index != i {
+			t.Fatalf("node at %d has index %d", i, n.index)
+		}
+		if i > 0 && n.Count > s.order[i-1].Count {
+			t.Fatalf("order is not non-increasing at %d: %d after %d", i, n.Count, s.order[i-1].Count)
+		}
+		if n.Left != nil && n.Count != n.Left.Count+n.Right.Count {
+			t.Fatalf("node at %d has count %d, children %d and %d", i, n.Count, n.Left.Count, n.Right.Count)
+		}
+	}
+	for k := 1; 2*k < len(s.order); k++ {
+		a, b := s.order[2*k-1], s.order[2*k]
+		if a.Parent != b.Parent || a.Parent == nil {
+			t.Fatalf("nodes at %d and %d are not siblings", 2*k-1, 2*k)
+		}
+	}
+	if len(s.order)%2 == 0 {
+		t.Fatalf("order has even length %d", len(s.order))
+	}
+	counts := make(map[ValueType]int)
+	for _, v := range window {
+		counts[v]++
+	}
+	for v, n := range s.nodes {
+		c := counts[ValueType(v)]
+		if n == nil {
+			if c > 0 {
+				t.Fatalf("symbol %d occurs %d times in the window, but has no leaf", v, c)
+			}
+			continue
+		}
+		if n.Left != nil || n.Value != ValueType(v) || n.Count != c {
+			t.Fatalf("leaf of symbol %d: value %d, count %d, want count %d", v, n.Value, n.Count, c)
+		}
+	}
+	if s.newNode.Count != 1 || s.eofNode.Count != 1 {
+		t.Fatalf("newValue and eofValue counts are %d and %d, want 1", s.newNode.Count, s.eofNode.Count)
+	}
+	if want := 2*(len(counts)+extraValues) - 1; len(s.order) != want {
+		t.Fatalf("tree has %d nodes, want %d", len(s.order), want)
+	}
+}
+
+// lastWindow возвращает последние size символов values или все values, если size < 0.
+func lastWindow(values []ValueType, size int) []ValueType {
+	if size > 0 && len(values) > size {
+		return values[len(values)-size:]
+	}
+	return values
+}
+
+func TestAdaptiveTree(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, winSize := range []int{1, 2, 7, 0, -1} {
+		for _, alphabet := range []int{3, 40, 256} {
+			o := &Options{WinSize: winSize, AlphabetSize: alphabet}
+			size := checkOptions(o).WinSize
+			var buf bytes.Buffer
+			w := NewWriterOptions(&buf, o)
+			values := make([]ValueType, 5000)
+			for i := range values {
+				// Распределение меняется по ходу потока, чтобы символы уходили из окна
+				v := int(rng.ExpFloat64()*float64(alphabet)/6) + i/1000
+				values[i] = ValueType(v % alphabet)
+				if err := w.WriteSymbol(values[i]); err != nil {
+					t.Fatal(err)
+				}
+				checkSymbols(t, w.symbols, lastWindow(values[:i+1], size))
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r := NewReaderOptions(&buf, o)
+			for i, want := range values {
+				if got, err := r.ReadSymbol(); err != nil || got != want {
+					t.Fatalf("window %d, alphabet %d, symbol %d: got %d, %v, want %d", winSize, alphabet, i, got, err, want)
+				}
+			}
+			if _, err := r.ReadSymbol(); err != io.EOF {
+				t.Fatalf("window %d, alphabet %d: got %v after the last symbol, want io.EOF", winSize, alphabet, err)
+			}
+			checkSymbols(t, r.symbols, lastWindow(values, size))
+		}
+	}
+}
+
+// testModes - все режимы кода Хаффмана.
+var testModes = []Mode{Adaptive, Static, MultiTable}
+
+// randomSymbols возвращает n символов алфавита размера alphabet с убывающими частотами.
+func randomSymbols(rng *rand.Rand, n, alphabet int) []ValueType {
+	values := make([]ValueType, n)
+	for i := range values {
+		values[i] = ValueType(int(rng.ExpFloat64()*float64(alphabet)/8) % alphabet)
+	}
+	return values
+}
+
+// writeSymbols записывает values в w.
+func writeSymbols(t *testing.T, w *Writer, values []ValueType) {
+	t.Helper()
+	for _, v := range values {
+		if err := w.WriteSymbol(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readSymbols читает символы из r до конца потока.
+func readSymbols(r *Reader) (values []ValueType, err error) {
+	for {
+		v, err := r.ReadSymbol()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return values, err
+		}
+		values = append(values, v)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, mode := range testModes {
+		for _, alphabet := range []int{2, 256, 5000} {
+			o := &Options{Mode: mode, AlphabetSize: alphabet}
+			for iter := 0; iter < 20; iter++ {
+				var buf bytes.Buffer
+				w := NewWriterOptions(&buf, o)
+				var values []ValueType
+				if rng.Intn(3) == 0 {
+					// Flush до первого символа ничего не записывает
+					if err := w.Flush(); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for c := rng.Intn(6); c >= 0; c-- {
+					chunk := randomSymbols(rng, rng.Intn(3000), alphabet)
+					writeSymbols(t, w, chunk)
+					values = append(values, chunk...)
+					// Последний фрагмент иногда завершается Close без Flush, а Flush иногда повторяется
+					for f := rng.Intn(3); f > 0 && c > 0; f-- {
+						if err := w.Flush(); err != nil {
+							t.Fatal(err)
+						}
+					}
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				got, err := readSymbols(NewReaderOptions(bytes.NewReader(buf.Bytes()), o))
+				if err != nil {
+					t.Fatalf("mode %d, alphabet %d: %v", mode, alphabet, err)
+				}
+				if len(got) != len(values) {
+					t.Fatalf("mode %d, alphabet %d: got %d symbols, want %d", mode, alphabet, len(got), len(values))
+				}
+				for i := range values {
+					if got[i] != values[i] {
+						t.Fatalf("mode %d, alphabet %d, symbol %d: got %d, want %d", mode, alphabet, i, got[i], values[i])
+					}
+				}
+				if len(values) > 0 {
+					data := buf.Bytes()[:buf.Len()-1]
+					if _, err := readSymbols(NewReaderOptions(bytes.NewReader(data), o)); err != ErrTruncated {
+						t.Fatalf("mode %d, alphabet %d: got %v for a truncated stream, want ErrTruncated", mode, alphabet, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, mode := range testModes {
+		o := &Options{Mode: mode, WinSize: 100}
+		first, second := randomSymbols(rng, 5000, 256), randomSymbols(rng, 3000, 256)
+		var want bytes.Buffer
+		w := NewWriterOptions(&want, o)
+		writeSymbols(t, w, second)
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		writeSymbols(t, w, first[:100])
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		// Тот же поток после закрытого потока и после незакрытого, в который вызывался Flush
+		for _, closed := range []bool{true, false} {
+			var discard, got bytes.Buffer
+			w := NewWriterOptions(&discard, o)
+			writeSymbols(t, w, first)
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			writeSymbols(t, w, second[:10])
+			if closed {
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w.Reset(&got)
+			writeSymbols(t, w, second)
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			writeSymbols(t, w, first[:100])
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Fatalf("mode %d, closed %v: output after Reset differs from a new Writer", mode, closed)
+			}
+		}
+	}
+}
+
+func TestFlushPipe(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for _, mode := range testModes {
+		for _, alphabet := range []int{2, 3, 256} {
+			o := &Options{Mode: mode, AlphabetSize: alphabet}
+			pr, pw := io.Pipe()
+			w := NewWriterOptions(pw, o)
+			// Читатель сообщает количество прочитанных символов; канал с запасом не дает ему
+			// заблокироваться на отправке, пока Writer ждет чтения из канала
+			read := make(chan int, 1<<16)
+			done := make(chan error, 1)
+			go func() {
+				r := NewReaderOptions(pr, o)
+				n := 0
+				for {
+					if _, err := r.ReadSymbol(); err != nil {
+						if err == io.EOF {
+							err = nil
+						}
+						done <- err
+						return
+					}
+					n++
+					read <- n
+				}
+			}()
+			total := 0
+			for c := 0; c < 100; c++ {
+				// Короткие фрагменты: при Flush код EOF часто оказывается коротким
+				chunk := randomSymbols(rng, 1+rng.Intn(4+c%40), alphabet)
+				writeSymbols(t, w, chunk)
+				total += len(chunk)
+				if err := w.Flush(); err != nil {
+					t.Fatal(err)
+				}
+				for n := 0; n < total; {
+					select {
+					case n = <-read:
+					case <-time.After(5 * time.Second):
+						t.Fatalf("mode %d, alphabet %d: reader blocked after %d of %d symbols", mode, alphabet, n, total)
+					}
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			pw.Close()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestFlushPadding(t *testing.T) {
+	for _, tc := range []struct {
+		maxLen, skipped uint8
+		want            int
+	}{{1, 0, 0}, {2, 0, 1}, {2, 1, 0}, {8, 7, 0}, {9, 7, 1}, {20, 0, 3}, {20, 3, 2}, {32, 7, 3}} {
+		if got := flushPadding(tc.maxLen, tc.skipped); got != tc.want {
+			t.Errorf("flushPadding(%d, %d) = %d, want %d", tc.maxLen, tc.skipped, got, tc.want)
+		}
+	}
+}
+
+// benchmarkModes - режимы, которые сравниваются в тестах производительности.
+var benchmarkModes = []struct {
+	name string
+	mode Mode
+}{{"Adaptive", Adaptive}, {"Static", Static}, {"MultiTable", MultiTable}}
+
+// benchmarkData читает wap.txt - самый большой файл testData.
+func benchmarkData(b *testing.B) []byte {
+	data, err := ioutil.ReadFile("../../testData/wap.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+func BenchmarkReader(b *testing.B) {
+	data := benchmarkData(b)
+	for _, m := range benchmarkModes {
+		b.Run(m.name, func(b *testing.B) {
+			o := &Options{Mode: m.mode}
+			var compressed bytes.Buffer
+			w := NewWriterOptions(&compressed, o)
+			if _, err := w.Write(data); err != nil {
+				b.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				b.Fatal(err)
+			}
+			out := make([]byte, len(data))
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r := NewReaderOptions(bytes.NewReader(compressed.Bytes()), o)
+				if _, err := io.ReadFull(r, out); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkWriter(b *testing.B) {
+	data := benchmarkData(b)
+	for _, m := range benchmarkModes {
+		b.Run(m.name, func(b *testing.B) {
+			o := &Options{Mode: m.mode}
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				w := NewWriterOptions(ioutil.Discard, o)
+				if _, err := w.Write(data); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/farit2000/compressor/src/bitio"
+)
+
+const (
+	// GroupSize - количество символов в группе, для которой выбирается таблица кодов.
+	GroupSize = 50
+	// MaxTables - наибольшее количество таблиц кодов в режиме MultiTable.
+	MaxTables = 6
+	// refineIterations - количество итераций уточнения таблиц и выбора таблиц для групп.
+	refineIterations = 4
+	// initialCost - длина кода, которой начальные таблицы оценивают символы вне своего диапазона.
+	initialCost = 15
+)
+
+// tablesFor возвращает количество таблиц, которое имеет смысл строить для n символов:
+// для коротких потоков затраты на запись таблиц не окупаются.
+func tablesFor(n int) int {
+	switch {
+	case n < 200:
+		return 2
+	case n < 600:
+		return 3
+	case n < 1200:
+		return 4
+	case n < 2400:
+		return 5
+	}
+	return 6
+}
+
+// writeMultiTable записывает values, разбитые на группы по GroupSize символов,
+// несколькими таблицами кодов (не более maxTables) с длиной кодов не более maxLen.
+// counts - частоты символов values.
+//
+// Формат: количество таблиц (3 бита), количество групп (32 бита), номера таблиц групп
+// (MTF, затем унарный код), длины кодов каждой таблицы (writeLengths) и коды символов.
+// Возвращает наибольшую длину кода во всех таблицах.
+func writeMultiTable(bw *bitio.Writer, values []ValueType, counts []int, maxTables int, maxLen uint8) (uint8, error) {
+	nt := tablesFor(len(values))
+	if nt > maxTables {
+		nt = maxTables
+	}
+	lengths := initialTables(counts, len(values), nt)
+	nGroups := (len(values) + GroupSize - 1) / GroupSize
+	selectors := make([]byte, nGroups)
+	freqs := make([][]int, nt)
+	for t := range freqs {
+		freqs[t] = make([]int, len(counts))
+	}
+	for iter := 0; iter < refineIterations; iter++ {
+		for t := range freqs {
+			for v := range freqs[t] {
+				freqs[t][v] = 0
+			}
+		}
+		for g := range selectors {
+			group := values[g*GroupSize:]
+			if len(group) > GroupSize {
+				group = group[:GroupSize]
+			}
+			best, bestCost := 0, -1
+			for t, ls := range lengths {
+				cost := 0
+				for _, v := range group {
+					cost += int(ls[v])
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = t, cost
+				}
+			}
+			selectors[g] = byte(best)
+			for _, v := range group {
+				freqs[best][v]++
+			}
+		}
+		// Каждая таблица должна кодировать все встречающиеся символы:
+		// на следующей итерации ее может выбрать любая группа.
+		for t := range lengths {
+			for v, c := range counts {
+				if c > 0 {
+					freqs[t][v]++
+				}
+			}
+			lengths[t] = CodeLengths(freqs[t], maxLen)
+		}
+	}
+
+	codes := make([][]uint64, nt)
+	for t, ls := range lengths {
+		codes[t] = CanonicalCodes(ls)
+	}
+	bw.TryWriteBits(uint64(nt), 3)
+	bw.TryWriteBits(uint64(nGroups), 32)
+	mtf := make([]byte, nt)
+	for t := range mtf {
+		mtf[t] = byte(t)
+	}
+	for _, sel := range selectors {
+		j := 0
+		for ; mtf[j] != sel; j++ {
+			bw.TryWriteBool(true)
+		}
+		bw.TryWriteBool(false)
+		copy(mtf[1:], mtf[:j])
+		mtf[0] = sel
+	}
+	if bw.TryError != nil {
+		return 0, bw.TryError
+	}
+	longest := uint8(0)
+	for _, ls := range lengths {
+		if err := writeLengths(bw, ls); err != nil {
+			return 0, err
+		}
+		if l := maxLength(ls); l > longest {
+			longest = l
+		}
+	}
+	for i, v := range values {
+		t := selectors[i/GroupSize]
+		bw.TryWriteBits(codes[t][v], lengths[t][v])
+	}
+	return longest, bw.TryError
+}
+
+// initialTables строит начальные таблицы, как в bzip2: диапазон значений символов делится
+// на nt частей с примерно равной суммарной частотой, и каждая таблица дешево оценивает
+// символы своей части и дорого - остальные.
+func initialTables(counts []int, total, nt int) [][]uint8 {
+	lengths := make([][]uint8, nt)
+	remaining, start := total, 0
+	for t := nt; t > 0; t-- {
+		target := remaining / t
+		end, sum := start-1, 0
+		for sum < target && end < len(counts)-1 {
+			end++
+			sum += counts[end]
+		}
+		if end > start && t != nt && t != 1 && (nt-t)%2 == 1 {
+			sum -= counts[end]
+			end--
+		}
+		ls := make([]uint8, len(counts))
+		for v := range ls {
+			if v < start || v > end {
+				ls[v] = initialCost
+			}
+		}
+		lengths[t-1] = ls
+		start, remaining = end+1, remaining-sum
+	}
+	return lengths
+}
+
+// multiTableDecoder декодирует символы, записанные writeMultiTable.
+type multiTableDecoder struct {
+	tables    []*canonicalDecoder // Декодеры таблиц
+	selectors []byte              // Номера таблиц групп
+	n         int                 // Количество декодированных символов
+}
+
+// readMultiTable читает описание таблиц и номера таблиц групп.
+// Возвращает io.EOF, если поток пуст.
+func readMultiTable(br *bitio.Reader, alphabetSize int) (*multiTableDecoder, error) {
+	u, err := br.ReadBits(3)
+	if err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, truncated(err)
+	}
+	nt := int(u)
+	if nt < 1 || nt > MaxTables {
+		return nil, fmt.Errorf("%w: invalid number of tables %d", ErrCorrupt, nt)
+	}
+	if u, err = br.ReadBits(32); err != nil {
+		return nil, truncated(err)
+	}
+	nGroups := int(u)
+	// Номера таблиц дописываются по мере чтения: каждый занимает хотя бы бит,
+	// поэтому поврежденное количество групп не приведет к огромному выделению памяти.
+	d := &multiTableDecoder{}
+	mtf := make([]byte, nt)
+	for t := range mtf {
+		mtf[t] = byte(t)
+	}
+	for g := 0; g < nGroups; g++ {
+		j := 0
+		for br.TryReadBool() {
+			if j++; j >= nt {
+				return nil, fmt.Errorf("%w: invalid table selector", ErrCorrupt)
+			}
+		}
+		if br.TryError != nil {
+			return nil, truncated(br.TryError)
+		}
+		sel := mtf[j]
+		copy(mtf[1:], mtf[:j])
+		mtf[0] = sel
+		d.selectors = append(d.selectors, sel)
+	}
+	for t := 0; t < nt; t++ {
+		lengths, err := readLengths(br, alphabetSize)
+		if err != nil {
+			if err == io.EOF {
+				err = ErrTruncated
+			}
+			return nil, err
+		}
+		table, err := newCanonicalDecoder(lengths)
+		if err != nil {
+			return nil, err
+		}
+		d.tables = append(d.tables, table)
+	}
+	return d, nil
+}
+
+// maxLen возвращает наибольшую длину кода во всех таблицах.
+func (d *multiTableDecoder) maxLen() (maxLen uint8) {
+	for _, t := range d.tables {
+		if t.maxLen > maxLen {
+			maxLen = t.maxLen
+		}
+	}
+	return
+}
+
+// decode читает следующий символ кодом таблицы его группы.
+func (d *multiTableDecoder) decode(br *bitio.Reader) (ValueType, error) {
+	g := d.n / GroupSize
+	if g >= len(d.selectors) {
+		return 0, fmt.Errorf("%w: more symbols than groups", ErrCorrupt)
+	}
+	d.n++
+	return d.tables[d.selectors[g]].decode(br)
+}
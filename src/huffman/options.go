@@ -1,5 +1,38 @@
 package huffman
 
+import (
+	"fmt"
+	"math/bits"
+)
+
+// DefaultWinSize - размер скользящего окна по умолчанию.
+const DefaultWinSize = 2048
+
+// DefaultAlphabetSize - размер алфавита по умолчанию: все значения байта.
+const DefaultAlphabetSize = 256
+
+// MaxAlphabetSize - наибольший размер алфавита. Таблицы адаптивного кода и частоты
+// полустатического кода занимают память, пропорциональную размеру алфавита.
+const MaxAlphabetSize = 1 << 20
+
+// Mode - способ построения кода Хаффмана.
+type Mode byte
+
+const (
+	// Adaptive - адаптивный код: после каждого символа дерево обновляется (алгоритм FGK)
+	// по частотам символов в скользящем окне. Данные записываются сразу.
+	Adaptive Mode = iota + 1
+	// Static - полустатический канонический код: Writer накапливает все символы,
+	// при закрытии строит код по их частотам, записывает длины кодов, а затем сами коды.
+	// Декодер восстанавливает канонический код по длинам. WinSize не используется.
+	Static
+	// MultiTable - несколько полустатических канонических кодов (не более Options.Tables),
+	// как в bzip2: символы разбиваются на группы по GroupSize, и для каждой группы
+	// выбирается таблица, кодирующая ее короче всего. Таблицы и выбор для групп
+	// уточняются итеративно. WinSize не используется.
+	MultiTable
+)
+
 type Options struct {
 	// WinSize указывает размер скользящего окна, которое используется для управления
 	// таблица символов.
@@ -7,6 +40,21 @@ type Options struct {
 	// Отрицательные значения означают, что нельзя использовать скользящее окно, то есть таблица символов
 	// рассчитывается на основе всех ранее встреченных символов.
 	WinSize int
+	// AlphabetSize - количество различных значений символов: кодируются значения [0, AlphabetSize).
+	// 0 означает байты (256 значений). Значения больше 256 можно записывать только через
+	// Writer.WriteSymbol и читать через Reader.ReadSymbol. Не больше MaxAlphabetSize.
+	// Новые символы адаптивного кода записываются ⌈log2 AlphabetSize⌉ битами,
+	// а длины полустатических кодов - только для встретившихся значений.
+	AlphabetSize int
+	// Mode - способ построения кода. 0 означает Adaptive.
+	Mode Mode
+	// Tables - наибольшее количество таблиц кодов в режиме MultiTable, от 1 до MaxTables.
+	// 0 означает MaxTables. Декодеру не нужно.
+	Tables int
+	// MaxCodeLen - наибольшая длина кода в режимах Static и MultiTable, не больше MaxCodeLen.
+	// 0 означает DefaultMaxCodeLen. Если значение слишком мало для размера алфавита,
+	// оно увеличивается до минимально возможного. Декодеру не нужно.
+	MaxCodeLen int
 }
 
 // checkOptions возвращает новые параметры, в которых "отсутствующие" поля (с нулевым значением) устанавливаются в значения по умолчанию.
@@ -18,7 +66,37 @@ func checkOptions(o *Options) *Options {
 		*o2 = *o
 	}
 	if o2.WinSize == 0 {
-		o2.WinSize = 2048
+		o2.WinSize = DefaultWinSize
+	}
+	if o2.AlphabetSize <= 0 {
+		o2.AlphabetSize = DefaultAlphabetSize
+	}
+	if o2.Mode == 0 {
+		o2.Mode = Adaptive
+	}
+	if o2.Tables <= 0 || o2.Tables > MaxTables {
+		o2.Tables = MaxTables
+	}
+	if o2.MaxCodeLen <= 0 {
+		o2.MaxCodeLen = DefaultMaxCodeLen
+	}
+	if o2.MaxCodeLen > MaxCodeLen {
+		o2.MaxCodeLen = MaxCodeLen
+	}
+	// Все символы алфавита и EOF должны получить коды
+	if minLen := bits.Len(uint(o2.AlphabetSize)); o2.MaxCodeLen < minLen {
+		o2.MaxCodeLen = minLen
 	}
 	return o2
-}
\ No newline at end of file
+}
+
+// validate проверяет параметры, обработанные checkOptions.
+func (o *Options) validate() error {
+	if o.AlphabetSize > MaxAlphabetSize {
+		return fmt.Errorf("huffman: alphabet size %d exceeds %d", o.AlphabetSize, MaxAlphabetSize)
+	}
+	if o.Mode < Adaptive || o.Mode > MultiTable {
+		return fmt.Errorf("huffman: unknown mode %d", o.Mode)
+	}
+	return nil
+}
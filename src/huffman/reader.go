@@ -1,15 +1,30 @@
 package huffman
 
 import (
+	"errors"
+	"fmt"
 	"github.com/farit2000/compressor/src/bitio"
 	"io"
 )
 
+var (
+	// ErrCorrupt возвращается, если сжатый поток не мог быть создан Writer.
+	ErrCorrupt = errors.New("huffman: corrupt data")
+	// ErrTruncated возвращается, если сжатый поток закончился до символа EOF.
+	ErrTruncated = errors.New("huffman: truncated data")
+)
+
 // Reader - это реализация считывателя Хаффмана.
 // Он также реализует io.ByteReader.
 type Reader struct {
 	*symbols
-	br *bitio.Reader
+	br      *bitio.Reader
+	mode    Mode
+	static  *canonicalDecoder  // Декодер полустатического кода, создается после чтения длин кодов
+	multi   *multiTableDecoder // Декодер режима MultiTable, создается после чтения таблиц
+	started bool               // Сообщает, был ли прочитан хотя бы один символ
+	eof     bool               // Сообщает, был ли прочитан символ EOF
+	err     error              // Ошибка в параметрах, возвращается всеми вызовами
 }
 
 // NewReader возвращает новый Reader, используя указанный io.Reader в качестве ввода (источника),
@@ -19,10 +34,21 @@ func NewReader(in io.Reader) *Reader {
 }
 
 // NewReaderOptions возвращает новый Reader, используя указанный io.Reader в качестве входа (источника)
-// с указанными опциями.
+// с указанными опциями. Ошибка в параметрах будет возвращена первым вызовом Read или ReadSymbol.
 func NewReaderOptions(in io.Reader, o *Options) *Reader {
 	o = checkOptions(o)
-	return &Reader{symbols: newSymbols(o), br: bitio.NewReader(in)}
+	r := &Reader{br: bitio.NewReader(in), mode: o.Mode}
+	if r.err = o.validate(); r.err != nil {
+		r.symbols = &symbols{}
+		return r
+	}
+	if o.Mode != Adaptive {
+		// Таблицы адаптивного кода нужны только в режиме Adaptive
+		r.symbols = &symbols{alphabetSize: o.AlphabetSize}
+	} else {
+		r.symbols = newSymbols(o)
+	}
+	return r
 }
 
 // Чтение распаковывает до len (p) байтов из источника.
@@ -36,31 +62,158 @@ func (r *Reader) Read(p []byte) (n int, err error) {
 }
 
 // ReadByte распаковывает один байт.
-func (r *Reader) ReadByte() (b byte, err error) {
-	// Read Huffman code
+// Если размер алфавита больше 256, символы за пределами байта возвращаются как ErrCorrupt,
+// такие потоки нужно читать через ReadSymbol.
+func (r *Reader) ReadByte() (byte, error) {
+	value, err := r.ReadSymbol()
+	if err != nil {
+		return 0, err
+	}
+	if value > 255 {
+		return 0, fmt.Errorf("%w: symbol %d does not fit in a byte", ErrCorrupt, value)
+	}
+	return byte(value), nil
+}
+
+// ReadSymbol распаковывает один символ из [0, Options.AlphabetSize).
+// Возвращает io.EOF после символа EOF, а также если поток пуст.
+// Места, где Writer вызывал Flush, читаются прозрачно.
+func (r *Reader) ReadSymbol() (value ValueType, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.eof {
+		return 0, io.EOF
+	}
+	for {
+		var end bool
+		switch r.mode {
+		case Static:
+			value, end, err = r.readStatic()
+		case MultiTable:
+			value, end, err = r.readMultiTable()
+		default:
+			value, end, err = r.readAdaptive()
+		}
+		if err != nil || !end {
+			return
+		}
+		r.started = true
+		// Символ EOF: бит продолжения сообщает, вызывал ли Writer здесь Flush
+		var more bool
+		if more, err = r.br.ReadBool(); err != nil {
+			return 0, truncated(err)
+		}
+		if !more {
+			r.eof = true
+			return 0, io.EOF
+		}
+		skipped := r.br.Align()
+		if r.static != nil || r.multi != nil {
+			var maxLen uint8
+			if r.static != nil {
+				maxLen = r.static.maxLen
+			} else {
+				maxLen = r.multi.maxLen()
+			}
+			for i := flushPadding(maxLen, skipped); i > 0; i-- {
+				if _, err = r.br.ReadByte(); err != nil {
+					return 0, truncated(err)
+				}
+			}
+			// Следующий сегмент начинается с собственных длин кодов
+			r.static, r.multi = nil, nil
+		}
+	}
+}
+
+// readAdaptive распаковывает один символ адаптивного кода. end сообщает, что прочитан код EOF.
+func (r *Reader) readAdaptive() (value ValueType, end bool, err error) {
 	br := r.br
 	node := r.root
-	for node.Left != nil { // читаем, пока не дойдем до листа
+	for bits := 0; node.Left != nil; bits++ { // читаем, пока не дойдем до листа
 		var right bool
 		if right, err = br.ReadBool(); err != nil {
-			return
+			if err == io.EOF && bits == 0 && !r.started {
+				return // пустой поток
+			}
+			return 0, false, truncated(err)
 		} else if right {
 			node = node.Right
 		} else {
 			node = node.Left
 		}
 	}
+	r.started = true
 	switch node.Value {
 	case newValue:
-		if b, err = br.ReadByte(); err != nil {
-			return
+		var u uint64
+		if u, err = br.ReadBits(r.literalBits); err != nil {
+			return 0, false, truncated(err)
+		}
+		value = ValueType(u)
+		if int(value) >= r.alphabetSize {
+			return 0, false, fmt.Errorf("%w: symbol %d is outside the alphabet of %d symbols", ErrCorrupt, value, r.alphabetSize)
+		}
+		if r.nodes[value] != nil {
+			return 0, false, fmt.Errorf("%w: symbol %d is transmitted as new, but is already known", ErrCorrupt, value)
 		}
-		r.insert(ValueType(b))
+		r.insert(value)
 		return
 	case eofValue:
-		return 0, io.EOF
+		return 0, true, nil
 	default:
 		r.update(node)
-		return byte(node.Value), nil
+		return node.Value, false, nil
+	}
+}
+
+// readStatic распаковывает один символ полустатического кода,
+// перед первым символом сегмента читая длины кодов. end сообщает, что прочитан код EOF.
+func (r *Reader) readStatic() (value ValueType, end bool, err error) {
+	if r.static == nil {
+		// Пустой поток не содержит даже длин кодов, тогда readLengths вернет io.EOF
+		lengths, err := readLengths(r.br, r.alphabetSize+1)
+		if err != nil {
+			return 0, false, r.segmentError(err)
+		}
+		if r.static, err = newCanonicalDecoder(lengths); err != nil {
+			return 0, false, err
+		}
+	}
+	if value, err = r.static.decode(r.br); err != nil {
+		return 0, false, err
+	}
+	return value, int(value) == r.alphabetSize, nil
+}
+
+// readMultiTable распаковывает один символ режима MultiTable,
+// перед первым символом сегмента читая таблицы кодов. end сообщает, что прочитан код EOF.
+func (r *Reader) readMultiTable() (value ValueType, end bool, err error) {
+	if r.multi == nil {
+		if r.multi, err = readMultiTable(r.br, r.alphabetSize+1); err != nil {
+			return 0, false, r.segmentError(err)
+		}
+	}
+	if value, err = r.multi.decode(r.br); err != nil {
+		return 0, false, err
+	}
+	return value, int(value) == r.alphabetSize, nil
+}
+
+// segmentError заменяет io.EOF перед сегментом, следующим за Flush, на ErrTruncated:
+// пустым может быть только весь поток.
+func (r *Reader) segmentError(err error) error {
+	if err == io.EOF && r.started {
+		return ErrTruncated
+	}
+	return err
+}
+
+// truncated заменяет конец входных данных посреди потока на ErrTruncated.
+func truncated(err error) error {
+	if err == io.EOF || err == bitio.ErrTruncated {
+		return ErrTruncated
 	}
+	return err
 }
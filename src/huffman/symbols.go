@@ -1,14 +1,14 @@
 package huffman
 
 import (
+	"math/bits"
 	"sort"
 )
 
 const (
-	newValue    ValueType           = 1<<31 - 1 - iota // Значение, представляющее новое значение
-	eofValue                                           // Значение, представляющее конец данных
-	extraValues = iota                                 // Количество дополнительных пользовательских значений
-	maxValues   = 256 + extraValues                    // Максимальные значения: количество байтов + дополнительные значения
+	newValue    ValueType = 1<<31 - 1 - iota // Значение, представляющее новое значение
+	eofValue                                 // Значение, представляющее конец данных
+	extraValues = iota                       // Количество дополнительных пользовательских значений
 )
 
 // win - буфер скользящего окна, основа таблицы символов.
@@ -30,56 +30,84 @@ func (w *win) store(symbol ValueType) {
 	}
 }
 
-// символы управляют таблицей символов и их частотами.
+// symbols управляют адаптивным деревом Хаффмана и частотами символов в скользящем окне.
+// Дерево обновляется алгоритмом FGK: узлы хранятся в order по невозрастанию Node.Count, а братья
+// занимают соседние позиции (свойство братства). Тогда изменение частоты символа на 1 сводится
+// к обменам узлов на пути от листа к корню, и дерево остается деревом Хаффмана без перестройки.
+// Частоты всех узлов положительны (newValue и eofValue всегда имеют частоту 1), поэтому
+// частота узла строго больше частот его потомков.
 type symbols struct {
-	// листья дерева Хаффмана, ранее встреченные символы.
-	// Отсортировано по Node.Count, потомку (так что новые узлы можно просто добавлять)!
-	leaves []*Node
-	buffer []*Node // Многоразовый буфер для передачи при построении дерева Хаффмана
-	root *Node // Корень дерева Хаффмана.
-	valueMap map[ValueType]*Node // Сопоставить значение с узлом
-	win *win // Буфер окна, ноль, если буфер окна не используется
+	root         *Node
+	order        []*Node // Узлы дерева по невозрастанию Count: order[0] - корень, order[2k-1] и order[2k] - братья
+	nodes        []*Node // Листья встреченных символов по значению, nil - символа нет в окне
+	newNode      *Node   // Лист newValue
+	eofNode      *Node   // Лист eofValue
+	win          *win    // Буфер окна, nil, если буфер окна не используется
+	alphabetSize int     // Количество различных значений символов
+	literalBits  uint8   // Количество битов, которыми записывается новое значение
 }
 
 // newSymbols создает новые символы.
 func newSymbols(o *Options) *symbols {
-	// начальные листья: 2 узла (newValue и eofValue) с count = 1 и большой емкостью
-	leaves := make([]*Node, extraValues, maxValues)
-	leaves[0] = &Node{Value: newValue, Count: 1}
-	leaves[1] = &Node{Value: eofValue, Count: 1}
-	valueMap := make(map[ValueType]*Node, cap(leaves))
-	for _, v := range leaves {
-		valueMap[v.Value] = v
-	}
-	s := &symbols{leaves: leaves, valueMap: valueMap, buffer: make([]*Node, 0, maxValues)}
+	s := &symbols{nodes: make([]*Node, o.AlphabetSize),
+		alphabetSize: o.AlphabetSize, literalBits: uint8(bits.Len(uint(o.AlphabetSize - 1)))}
+	s.order = make([]*Node, 0, 2*(o.AlphabetSize+extraValues)-1)
 	if o.WinSize > 0 {
 		s.win = &win{buf: make([]ValueType, o.WinSize)}
 	}
-	// Читателю нужно сразу же подготовить дерево Хаффмана, поэтому создайте его:
-	s.rebuildTree()
+	s.reset()
 	return s
 }
 
+// reset возвращает символы в начальное состояние, сохраняя выделенные таблицы.
+func (s *symbols) reset() {
+	for _, n := range s.order {
+		if n.Left == nil && int(n.Value) < len(s.nodes) {
+			s.nodes[n.Value] = nil
+		}
+	}
+	// Начальное дерево: корень и 2 листа (newValue и eofValue) с count = 1
+	s.newNode = &Node{Value: newValue, Count: 1}
+	s.eofNode = &Node{Value: eofValue, Count: 1}
+	s.root = &Node{Left: s.newNode, Right: s.eofNode, Count: 2}
+	s.newNode.Parent, s.eofNode.Parent = s.root, s.root
+	s.order = s.order[:0]
+	s.push(s.root)
+	s.push(s.newNode)
+	s.push(s.eofNode)
+	if s.win != nil {
+		s.win.pos, s.win.filled = 0, false
+	}
+}
+
+// push добавляет узел в конец order.
+func (s *symbols) push(n *Node) {
+	n.index = len(s.order)
+	s.order = append(s.order, n)
+}
+
 // update обновляет таблицу символов, увеличивая счетчик вхождений указанного узла.
 func (s *symbols) update(node *Node) {
-	// Мы должны отсортировать листья!
-	// Итак, сначала находим узел в срезе листьев с помощью двоичного поиска
-	// (помните: листья сортируются по потомку Node.Count)
-	ls, count := s.leaves, node.Count
-	idx := sort.Search(len(ls)-extraValues, func(i int) bool { return ls[i].Count <= count })
-	idx2 := idx // Store it for later use
-	// idx указывает на первый (самый низкий) узел, имеющий счетчик.
-	// Может быть больше узлов с таким же количеством, найдем наш узел:
-	for ; ls[idx] != node; idx++ {}
-	// Если есть больше узлов с таким же количеством, наш узел должен быть переключен
-	// с узлом, имеющим такое же количество и самый низкий индекс
-	// (поэтому срез остается отсортированным после увеличения счетчика нашего узла).
-	if idx2 != idx {
-		ls[idx2], ls[idx] = ls[idx], ls[idx2]
-	}
-	node.Count++
+	s.increment(node)
 	s.updateWin(node.Value)
-	s.rebuildTree()
+}
+
+// insert вставляет обнаруженный новый символ.
+func (s *symbols) insert(symbol ValueType) {
+	// Самый легкий узел (последний в order) заменяется внутренним узлом, потомки которого -
+	// он сам и лист нового символа с нулевой частотой. Новые узлы становятся последней парой братьев.
+	last := s.order[len(s.order)-1]
+	node := &Node{Value: symbol}
+	parent := &Node{Parent: last.Parent, Left: last, Right: node, Count: last.Count}
+	s.replaceChild(last.Parent, last, parent)
+	parent.index = last.index
+	s.order[parent.index] = parent
+	last.Parent, node.Parent = parent, parent
+	s.push(last)
+	s.push(node)
+	s.nodes[symbol] = node
+	s.increment(node)
+	s.updateWin(symbol)
 }
 
 // updateWin обновляет окно: сдвигает его, если оно уже заполнено, и сохраняет текущий обработанный символ.
@@ -89,61 +117,81 @@ func (s *symbols) updateWin(symbol ValueType) {
 	}
 	if s.win.filled {
 		// Обрабатываем перемещение символа из оконного буфера:
-		node := s.valueMap[s.win.buf[s.win.pos]]
-		// сначала находим узел в срезе листьев с помощью двоичного поиска
-		ls, count := s.leaves, node.Count
-		idx := sort.Search(len(ls)-extraValues, func(i int) bool { return ls[i].Count <= count })
-		// idx указывает на первый (самый низкий) узел, имеющий счетчик.
-		// Может быть больше узлов с таким же количеством
-		for ; ls[idx] != node; idx++ {
-		}
-		if count > 1 {
-			// Если есть больше узлов с таким же количеством, наш узел должен быть переключен
-			// с узлом, имеющим такое же количество и самый высокий индекс
-			// (поэтому срез остается отсортированным после уменьшения счетчика нашего узла)
-			idx2 := idx + 1
-			for ; idx2 < len(ls)-extraValues && ls[idx2].Count == count; idx2++ {}
-			if idx2 = idx2 - 1; idx2 != idx {
-				ls[idx2], ls[idx] = ls[idx], ls[idx2]
-			}
-			node.Count--
+		node := s.nodes[s.win.buf[s.win.pos]]
+		if node.Count > 1 {
+			s.decrement(node)
 		} else {
 			// Счетчик уменьшится до нуля: удалить узел
-			s.leaves = append(ls[:idx], ls[idx+1:]...)
-			// Также удаляем из valueMap:
-			delete(s.valueMap, node.Value)
+			s.remove(node)
 		}
 	}
 	s.win.store(symbol)
 }
 
-// insert вставляет обнаруженный новый символ.
-func (s *symbols) insert(symbol ValueType) {
-	node := &Node{Value: symbol, Count: 1}
-	// оставляет отсортированный потомок, поэтому мы можем просто добавить.
-	// Но дополнительные значения в конце никогда не увеличиваются, поэтому мы вставляем перед ними:
-	ls := s.leaves
-	// расширить на 1 для нового узла
-	ls = ls[:len(ls)+1]
-	// Копируем лишние значения в конец (на 1 выше)
-	copy(ls[len(ls)-extraValues:], ls[len(ls)-extraValues-1:])
-	// И вставляем новый узел
-	ls[len(ls)-extraValues-1] = node
-	s.leaves = ls
-	s.valueMap[node.Value] = node
-	s.updateWin(node.Value)
-	s.rebuildTree()
+// increment увеличивает на 1 частоту листа n и его предков. Перед увеличением каждый узел
+// меняется местами с первым в order узлом той же частоты, поэтому порядок сохраняется.
+func (s *symbols) increment(n *Node) {
+	for ; n != nil; n = n.Parent {
+		count := n.Count
+		first := sort.Search(n.index, func(i int) bool { return s.order[i].Count <= count })
+		if first != n.index {
+			s.swap(n, s.order[first])
+		}
+		n.Count++
+	}
+}
+
+// decrement уменьшает на 1 частоту листа n и его предков, меняя каждый узел местами
+// с последним в order узлом той же частоты.
+func (s *symbols) decrement(n *Node) {
+	for ; n != nil; n = n.Parent {
+		count := n.Count
+		rest := s.order[n.index:]
+		last := n.index + sort.Search(len(rest), func(i int) bool { return rest[i].Count < count }) - 1
+		if last != n.index {
+			s.swap(n, s.order[last])
+		}
+		n.Count--
+	}
+}
+
+// remove удаляет из дерева лист n с частотой 1.
+func (s *symbols) remove(n *Node) {
+	// После уменьшения частоты до 0 лист - последний в order, а его брат - предпоследний.
+	// Родитель заменяется братом: частоты у них теперь равны.
+	s.decrement(n)
+	parent, sibling := n.Parent, s.order[len(s.order)-2]
+	sibling.Parent = parent.Parent
+	s.replaceChild(parent.Parent, parent, sibling)
+	sibling.index = parent.index
+	s.order[sibling.index] = sibling
+	s.order = s.order[:len(s.order)-2]
+	s.nodes[n.Value] = nil
+}
+
+// swap меняет местами узлы a и b - вместе с поддеревьями - в дереве и в order.
+// Ни один из них не должен быть предком другого.
+func (s *symbols) swap(a, b *Node) {
+	pa, pb := a.Parent, b.Parent
+	if pa == pb {
+		pa.Left, pa.Right = pa.Right, pa.Left
+	} else {
+		s.replaceChild(pa, a, b)
+		s.replaceChild(pb, b, a)
+		a.Parent, b.Parent = pb, pa
+	}
+	s.order[a.index], s.order[b.index] = b, a
+	a.index, b.index = b.index, a.index
 }
 
-// rebuildTree перестраивает дерево Хаффмана.
-func (s *symbols) rebuildTree() {
-	// BuildSorted () изменяет срез, поэтому сделайте копию:
-	// оставляет отсортированный потомок, поэтому заполняем в обратном направлении:
-	j := len(s.leaves)
-	ls := s.buffer[:j]
-	for _, v := range s.leaves {
-		j--
-		ls[j] = v
+// replaceChild заменяет потомка old узла parent на n; если parent == nil, n становится корнем.
+func (s *symbols) replaceChild(parent, old, n *Node) {
+	switch {
+	case parent == nil:
+		s.root = n
+	case parent.Left == old:
+		parent.Left = n
+	default:
+		parent.Right = n
 	}
-	s.root = BuildSorted(ls)
 }
@@ -1,15 +1,31 @@
 package huffman
 
 import (
+	"fmt"
 	"github.com/farit2000/compressor/src/bitio"
 	"io"
 )
 
 // Writer - это реализация модуля записи Huffman.
 // Должен быть закрыт для правильной отправки EOF.
+//
+// После символа EOF записывается бит продолжения: 0 завершает поток, а 1 (его записывает Flush)
+// означает, что после выравнивания по границе байта поток продолжается.
 type Writer struct {
 	*symbols
-	bw *bitio.Writer
+	bw      *bitio.Writer
+	static  *staticBuffer // Накопленные символы в режимах Static и MultiTable, nil в режиме Adaptive
+	started bool          // Сообщает, был ли записан хотя бы один символ
+	pending bool          // Сообщает, были ли записаны символы после последнего Flush (режим Adaptive)
+	err     error         // Ошибка в параметрах, возвращается всеми вызовами
+}
+
+// staticBuffer накапливает символы и их частоты до построения полустатического кода.
+type staticBuffer struct {
+	values []ValueType // Записанные символы
+	counts []int       // Частоты символов; последний элемент - частота EOF
+	tables int         // Наибольшее количество таблиц кодов, 0 - режим Static
+	maxLen uint8       // Наибольшая длина кода
 }
 
 // NewWriter возвращает новый Writer, используя указанный io.Writer в качестве вывода,
@@ -20,9 +36,24 @@ func NewWriter(out io.Writer) *Writer {
 
 // Writer сможет только правильно декодировать поток
 // создается Writer, если одни и те же параметры используются как в Reader, так и Writer.
+// Ошибка в параметрах будет возвращена первым вызовом Write, WriteSymbol или Close.
 func NewWriterOptions(out io.Writer, o *Options) *Writer {
 	o = checkOptions(o)
-	return &Writer{symbols: newSymbols(o), bw: bitio.NewWriter(out)}
+	w := &Writer{bw: bitio.NewWriter(out)}
+	if w.err = o.validate(); w.err != nil {
+		w.symbols = &symbols{}
+		return w
+	}
+	if o.Mode == Static || o.Mode == MultiTable {
+		w.symbols = &symbols{alphabetSize: o.AlphabetSize}
+		w.static = &staticBuffer{counts: make([]int, o.AlphabetSize+1), maxLen: uint8(o.MaxCodeLen)}
+		if o.Mode == MultiTable {
+			w.static.tables = o.Tables
+		}
+	} else {
+		w.symbols = newSymbols(o)
+	}
+	return w
 }
 
 // Write записывает сжатую форму p в базовый io.Writer.
@@ -38,16 +69,34 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 
 // WriteByte записывает сжатую форму b в базовый io.Writer.
 // Сжатый байт (байты) не обязательно сбрасывается до закрытия Writer.
-func (w *Writer) WriteByte(b byte) (err error) {
-	value := ValueType(b)
-	node := w.valueMap[value]
+func (w *Writer) WriteByte(b byte) error {
+	return w.WriteSymbol(ValueType(b))
+}
+
+// WriteSymbol записывает сжатую форму символа value, лежащего в пределах [0, Options.AlphabetSize).
+// Сжатый символ не обязательно сбрасывается до закрытия Writer.
+func (w *Writer) WriteSymbol(value ValueType) (err error) {
+	if w.err != nil {
+		return w.err
+	}
+	if value < 0 || int(value) >= w.alphabetSize {
+		return fmt.Errorf("huffman: symbol %d is outside the alphabet of %d symbols", value, w.alphabetSize)
+	}
+	w.started = true
+	if w.static != nil {
+		w.static.values = append(w.static.values, value)
+		w.static.counts[value]++
+		return nil
+	}
+	w.pending = true
+	node := w.nodes[value]
 	if node == nil {
 		// Новое значение, записываем код Хаффмана newValue
-		if err = w.bw.WriteBits(w.valueMap[newValue].Code()); err != nil {
+		if err = w.bw.WriteBits(w.newNode.Code()); err != nil {
 			return
 		}
 		// ... и новое значение
-		if err = w.bw.WriteByte(b); err != nil {
+		if err = w.bw.WriteBits(uint64(value), w.literalBits); err != nil {
 			return
 		}
 		w.insert(value)
@@ -61,16 +110,115 @@ func (w *Writer) WriteByte(b byte) (err error) {
 	return
 }
 
+// Flush записывает в базовый io.Writer все накопленные данные, не завершая поток:
+// код EOF, бит продолжения 1 и выравнивание по границе байта. Reader прочитает все символы,
+// записанные до Flush, не дожидаясь продолжения потока, и затем продолжит чтение.
+// Как и Flush в compress/flate, нужен сетевым протоколам и журналам, которые
+// передаются по частям; частые вызовы ухудшают сжатие.
+//
+// В режиме Adaptive дерево кода сохраняется. В режимах Static и MultiTable накопленные символы
+// записываются отдельным сегментом со своими длинами кодов, следующие символы начинают новый
+// сегмент. Если после предыдущего Flush символов не было, записываются только буферизованные байты.
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.static != nil {
+		if len(w.static.values) > 0 {
+			if err := w.writeSegment(true); err != nil {
+				return err
+			}
+		}
+	} else if w.pending {
+		w.bw.TryWriteBits(w.eofNode.Code())
+		w.bw.TryWriteBool(true)
+		if w.bw.TryError != nil {
+			return w.bw.TryError
+		}
+		w.pending = false
+	}
+	_, err := w.bw.Align()
+	return err
+}
+
 // Close закрывает модуль записи Хаффмана, правильно отправляя EOF.
-// Если базовый io.Writer реализует io.Closer,
-// он будет закрыт после отправки EOF.
+// Базовый io.Writer не закрывается. Если не было записано ни одного символа,
+// ничего не записывается.
 func (w *Writer) Close() (err error) {
-	// Если были какие-то данные, выписываем eofValue
-	if len(w.leaves) > 2 {
-		// Записываем код Хаффмана eofValue
-		if err = w.bw.WriteBits(w.valueMap[eofValue].Code()); err != nil {
+	if w.err != nil {
+		return w.err
+	}
+	if w.started {
+		if w.static != nil {
+			err = w.writeSegment(false)
+		} else {
+			w.bw.TryWriteBits(w.eofNode.Code())
+			w.bw.TryWriteBool(false)
+			err = w.bw.TryError
+		}
+		if err != nil {
 			return
 		}
+		w.started, w.pending = false, false
 	}
 	return w.bw.Close()
 }
+
+// Reset сбрасывает состояние Writer, делая его эквивалентным новому Writer с теми же параметрами,
+// который пишет в out. Выделенные таблицы символов используются повторно.
+// Незакрытый поток отбрасывается.
+func (w *Writer) Reset(out io.Writer) {
+	w.bw.Reset(out)
+	w.started, w.pending = false, false
+	if w.err != nil {
+		return
+	}
+	if w.static != nil {
+		w.static.values = w.static.values[:0]
+		for v := range w.static.counts {
+			w.static.counts[v] = 0
+		}
+	} else {
+		w.reset()
+	}
+}
+
+// writeSegment строит полустатический канонический код (или несколько кодов в режиме MultiTable)
+// по накопленным символам и записывает длины кодов, коды символов, код EOF и бит продолжения more.
+// Если more, дописывает выравнивание и нулевые байты flushPadding.
+func (w *Writer) writeSegment(more bool) error {
+	st := w.static
+	eof := ValueType(len(st.counts) - 1)
+	st.counts[eof] = 1
+	var maxLen uint8
+	if st.tables > 0 {
+		st.values = append(st.values, eof)
+		var err error
+		if maxLen, err = writeMultiTable(w.bw, st.values, st.counts, st.tables, st.maxLen); err != nil {
+			return err
+		}
+	} else {
+		lengths := CodeLengths(st.counts, st.maxLen)
+		codes := CanonicalCodes(lengths)
+		if err := writeLengths(w.bw, lengths); err != nil {
+			return err
+		}
+		for _, v := range st.values {
+			w.bw.TryWriteBits(codes[v], lengths[v])
+		}
+		w.bw.TryWriteBits(codes[eof], lengths[eof])
+		maxLen = maxLength(lengths)
+	}
+	w.bw.TryWriteBool(more)
+	if more {
+		skipped := w.bw.TryAlign()
+		for i := flushPadding(maxLen, skipped); i > 0; i-- {
+			w.bw.TryWriteByte(0)
+		}
+	}
+	st.values = st.values[:0]
+	for v := range st.counts {
+		st.counts[v] = 0
+	}
+	return w.bw.TryError
+}
@@ -1,160 +1,472 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"flag"
 	"fmt"
+	"github.com/farit2000/compressor/src/arith"
 	"github.com/farit2000/compressor/src/bwt"
+	"github.com/farit2000/compressor/src/fd"
 	"github.com/farit2000/compressor/src/huffman"
-	"github.com/farit2000/compressor/src/mtf"
-	"github.com/farit2000/compressor/src/rle"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
+	"path/filepath"
 )
 
-func check(e error) {
-	if e != nil {
-		panic(e)
+const usage = `Usage: fd <command> [flags]
+
+Commands:
+  compress    compress a file (BWTS -> MTF -> ZRLE -> Huffman, arithmetic coding or rANS;
+              with -9, BWTS -> context mixing for the best ratio)
+  decompress  decompress an .fd file
+  test        decompress an .fd file and verify checksums without writing output
+  list        show the blocks of an .fd file and their compression ratios
+  info        show the header and overall compression ratio of an .fd file
+
+A missing or "-" input or output path means stdin or stdout, e.g.:
+  tar c dir | fd compress | ssh host 'fd decompress > dir.tar'
+
+Run "fd <command> -h" for the flags of a command.
+
+Exit status: 0 success, 1 error, 2 usage error, 3 not an .fd file or unsupported
+version, 4 truncated data, 5 corrupt data, 6 checksum mismatch, 7 block too large.
+`
+
+// Коды завершения программы
+const (
+	exitOK        = 0
+	exitError     = 1 // Прочие ошибки, например ошибки ввода-вывода
+	exitUsage     = 2 // Неверные параметры командной строки
+	exitFormat    = 3 // Вход не является файлом .fd или его версия не поддерживается
+	exitTruncated = 4 // Сжатые данные обрываются
+	exitCorrupt   = 5 // Сжатые данные повреждены
+	exitChecksum  = 6 // Контрольная сумма распакованных данных не совпала
+	exitTooLarge  = 7 // Блок слишком велик для преобразования BWTS
+)
+
+// exitCodes сопоставляет ошибкам коды завершения; проверяются по порядку через errors.Is.
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{fd.ErrFormat, exitFormat},
+	{fd.ErrVersion, exitFormat},
+	{fd.ErrTruncated, exitTruncated},
+	{fd.ErrChecksum, exitChecksum},
+	{fd.ErrCorrupt, exitCorrupt},
+	{bwt.ErrTooLarge, exitTooLarge},
+}
+
+// command - подкоманда программы.
+type command struct {
+	name string
+	help string
+	run  func(c *command, args []string) error
+}
+
+var commands = []command{
+	{"compress", "[-i <file>] [-o <file.fd>] [-b KB] [-j N] [-9|--max] [-rle] [-coder huffman|arith|ans] [-huffman adaptive|static|multi] [-model order0|mtf]", runCompress},
+	{"decompress", "[-i <file.fd>] [-o <file>] [-j N]", runDecompress},
+	{"test", "[-i <file.fd>] [-j N]", runTest},
+	{"list", "[-i <file.fd>]", runList},
+	{"info", "[-i <file.fd>]", runInfo},
+}
+
+// errUsage возвращается, если команда вызвана с неверными параметрами.
+type errUsage struct{ msg string }
+
+func (e errUsage) Error() string { return e.msg }
+
+// stdio - путь, обозначающий стандартный ввод или вывод.
+const stdio = "-"
+
+// newFlagSet создает набор флагов подкоманды с общими флагами -i и -o.
+func newFlagSet(c *command, withOutput bool) (fs *flag.FlagSet, in, out *string) {
+	fs = flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: fd %s %s\n", c.name, c.help)
+		fs.PrintDefaults()
+	}
+	in = fs.String("i", stdio, `input file path ("-" for stdin)`)
+	if withOutput {
+		out = fs.String("o", stdio, `output file path ("-" for stdout)`)
 	}
+	return
 }
 
-// Метод компрессии, в котором используется 4 этапа сжатия BWTs -> RLE -> NTF -> Huffman
-func compress(inputFilePath string, outPutFilePath string) error {
-	normBytes, err := ioutil.ReadFile(inputFilePath)
+// parseFlags разбирает флаги подкоманды.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return errUsage{err.Error()}
+	}
+	if fs.NArg() > 0 {
+		return errUsage{fmt.Sprintf("unexpected arguments: %v", fs.Args())}
+	}
+	return nil
+}
 
-	//get bwt bytes
-	size := uint(len(normBytes))
-	bwtBytes := make([]byte, size)
-	bwtComp, err := bwt.NewBWTS()
-	if err != nil {
+func runCompress(c *command, args []string) error {
+	fs, in, out := newFlagSet(c, true)
+	blockSize := fs.Int("b", fd.DefaultBlockSize/1024, "block size in KB")
+	jobs := fs.Int("j", 0, "number of blocks compressed in parallel (0 means the number of CPUs)")
+	coder := fs.String("coder", "huffman", "entropy coder: huffman, arith (arithmetic coding, smaller but slower) or ans (rANS with static frequencies)")
+	mode := fs.String("huffman", "multi", "Huffman coding mode: adaptive, static or multi (several tables per block)")
+	model := fs.String("model", "mtf", "arithmetic coding model: order0 or mtf (structured model of MTF ranks)")
+	best := fs.Bool("max", false, "maximum compression: context mixing instead of MTF and entropy coding\n(several times slower, overrides -coder)")
+	fs.BoolVar(best, "9", false, "same as -max")
+	rle := fs.Bool("rle", false, "run-length encode BWTS output before MTF or context mixing\n(helps -9 on data with very long runs)")
+	if err := parseFlags(fs, args); err != nil {
 		return err
 	}
-	_, _, err = bwtComp.Forward(normBytes, bwtBytes)
-	check(err)
-
-	//get rle bytes
-	rleString := []byte(rle.RunLengthEncode(string(bwtBytes)))
+	o := &fd.Options{BlockSize: *blockSize * 1024, Concurrency: *jobs, RLE: *rle}
+	switch *coder {
+	case "huffman":
+		o.Coder = fd.CoderHuffman
+	case "arith":
+		o.Coder = fd.CoderArith
+	case "ans":
+		o.Coder = fd.CoderANS
+	default:
+		return errUsage{fmt.Sprintf("unknown entropy coder %q", *coder)}
+	}
+	if *best {
+		o.Coder = fd.CoderCM
+	}
+	switch *model {
+	case "order0":
+		o.Arith.Model = arith.Order0
+	case "mtf":
+		o.Arith.Model = arith.MTFRanks
+	default:
+		return errUsage{fmt.Sprintf("unknown arithmetic coding model %q", *model)}
+	}
+	switch *mode {
+	case "adaptive":
+		o.Huffman.Mode = huffman.Adaptive
+	case "static":
+		o.Huffman.Mode = huffman.Static
+	case "multi":
+		o.Huffman.Mode = huffman.MultiTable
+	default:
+		return errUsage{fmt.Sprintf("unknown Huffman mode %q", *mode)}
+	}
+	if err := fd.CheckBlockSize(o.BlockSize); err != nil {
+		return errUsage{err.Error()}
+	}
+	if err := compress(*in, *out, o); err != nil {
+		return err
+	}
+	if !isStdio(*out) {
+		fmt.Printf("Compress successful. Compressed file path is %s\n", *out)
+	}
+	return nil
+}
 
-	//get mtf bytes
-	alphabet := mtf.AlphabetCreate(rleString)
-	m := mtf.SymbolTable(alphabet)
-	mtfBytes := m.Encode(rleString)
-	mtfBytes = append(mtfBytes, alphabet...)
-	mtfBytes = append(mtfBytes, byte(len(alphabet)))
+func runDecompress(c *command, args []string) error {
+	fs, in, out := newFlagSet(c, true)
+	jobs := fs.Int("j", 0, "number of blocks decompressed in parallel (0 means the number of CPUs)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if err := decompress(*in, *out, &fd.Options{Concurrency: *jobs}); err != nil {
+		return err
+	}
+	if !isStdio(*out) {
+		fmt.Printf("Decompress successful. Decompressed file path is %s\n", *out)
+	}
+	return nil
+}
 
-	//write huffman bites
-	f, err := os.Create(outPutFilePath)
-	check(err)
-	w := huffman.NewWriter(f)
-	if _, err := w.Write(mtfBytes); err != nil {
-		log.Panicln("Failed to write:", err)
+func runTest(c *command, args []string) error {
+	fs, in, _ := newFlagSet(c, false)
+	jobs := fs.Int("j", 0, "number of blocks decompressed in parallel (0 means the number of CPUs)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
 	}
-	if err := w.Close(); err != nil {
-		log.Panicln("Failed to close:", err)
+	f, _, err := openInput(*in)
+	if err != nil {
+		return err
 	}
 	defer f.Close()
+	n, err := io.Copy(ioutil.Discard, fd.NewReaderOptions(f, &fd.Options{Concurrency: *jobs}))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: OK, %d bytes\n", *in, n)
+	return nil
+}
+
+func runList(c *command, args []string) error {
+	fs, in, _ := newFlagSet(c, false)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	info, err := stat(*in)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%6s %12s %12s %7s %8s\n", "block", "size", "compressed", "ratio", "crc32")
+	for i, b := range info.Blocks {
+		fmt.Printf("%6d %12d %12d %6.2f%% %08x\n", i, b.Size, b.CompressedSize, 100*b.Ratio(), b.CRC)
+	}
+	fmt.Printf("%6s %12d %12d %6.2f%% %08x\n", "total", info.Size, info.CompressedSize, 100*info.Ratio(), info.CRC)
+	return nil
+}
+
+func runInfo(c *command, args []string) error {
+	fs, in, _ := newFlagSet(c, false)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	info, err := stat(*in)
+	if err != nil {
+		return err
+	}
+	h := info.Header
+	fmt.Printf("file:            %s\n", *in)
+	fmt.Printf("format version:  %d\n", h.Version)
+	fmt.Printf("stages:          %s\n", stages(h.Flags))
+	fmt.Printf("block size:      %d\n", h.BlockSize)
+	if h.Flags.Has(fd.FlagHuffman) {
+		fmt.Printf("huffman mode:    %s\n", huffmanMode(h.Huffman.Mode))
+		if h.Huffman.Mode == huffman.Adaptive {
+			fmt.Printf("huffman window:  %d\n", h.Huffman.WinSize)
+		}
+	}
+	if h.Flags.Has(fd.FlagArith) {
+		fmt.Printf("arith model:     %s\n", h.Arith.Model)
+	}
+	fmt.Printf("blocks:          %d\n", len(info.Blocks))
+	fmt.Printf("original size:   %d\n", info.Size)
+	fmt.Printf("compressed size: %d\n", info.CompressedSize)
+	fmt.Printf("ratio:           %.2f%%\n", 100*info.Ratio())
+	fmt.Printf("crc32:           %08x\n", info.CRC)
 	return nil
 }
 
-// Метод декомпрессии, все происходит в обратном порядке
-func decompress(inputFilePath string, outPutFilePath string) error {
-	f, err := os.Open(inputFilePath)
-	check(err)
+// stages возвращает названия примененных этапов сжатия.
+func stages(flags fd.Flags) string {
+	names := []struct {
+		flag fd.Flags
+		name string
+	}{{fd.FlagBWTS, "BWTS"}, {fd.FlagRLE, "RLE"}, {fd.FlagMTF, "MTF"}, {fd.FlagZRLE, "ZRLE"}, {fd.FlagHuffman, "Huffman"}, {fd.FlagArith, "Arith"}, {fd.FlagANS, "ANS"}, {fd.FlagCM, "CM"}}
+	s := ""
+	for _, n := range names {
+		if flags.Has(n.flag) {
+			if s != "" {
+				s += " -> "
+			}
+			s += n.name
+		}
+	}
+	return s
+}
+
+// huffmanMode возвращает название способа кодирования Хаффмана.
+func huffmanMode(m huffman.Mode) string {
+	switch m {
+	case huffman.Adaptive:
+		return "adaptive"
+	case huffman.Static:
+		return "static"
+	case huffman.MultiTable:
+		return "multi"
+	}
+	return fmt.Sprintf("unknown (%d)", m)
+}
 
-	//get huffman bytes
-	r := huffman.NewReader(f)
+// stat открывает файл .fd и читает описание его блоков.
+func stat(path string) (*fd.Info, error) {
+	f, _, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
 	defer f.Close()
-	mtfBytes, err := ioutil.ReadAll(r)
-	check(err)
+	return fd.Stat(f)
+}
 
-	//get mtf bytes
-	mtfBytes, alphabet := mtf.GetAlphabet(mtfBytes)
-	m := mtf.SymbolTable(alphabet)
+// isStdio сообщает, обозначает ли путь стандартный ввод или вывод.
+func isStdio(path string) bool {
+	return path == "" || path == stdio
+}
 
-	//get rle bytes
-	rleBytes := m.Decode(mtfBytes)
-	//bwtBytes := m.Decode(mtfBytes)
+// openInput открывает входной файл или стандартный ввод.
+// Возвращает также размер данных, если вход - обычный файл, иначе 0.
+func openInput(path string) (f *os.File, size int64, err error) {
+	if isStdio(path) {
+		f = os.Stdin
+	} else if f, err = os.Open(path); err != nil {
+		return nil, 0, err
+	}
+	if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+		size = info.Size()
+	}
+	return f, size, nil
+}
 
-	//get bwt bytes
-	bwtBytes := []byte(rle.RunLengthDecode(string(rleBytes)))
+// createOutput создает выходной файл или возвращает стандартный вывод.
+// Данные пишутся во временный файл в каталоге path, который commitOutput переименует в path
+// только после успешного завершения, поэтому ошибка не портит уже существующий файл.
+// Если binary равен true, отказывается писать в терминал.
+func createOutput(in *os.File, path string, binary bool) (*os.File, error) {
+	if !isStdio(path) {
+		inInfo, err := in.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && os.SameFile(inInfo, info) {
+			return nil, errUsage{fmt.Sprintf("input and output are the same file %s", path)}
+		}
+		f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+		if err != nil {
+			return nil, err
+		}
+		// Права как у входного файла, как у gzip и bzip2
+		mode := os.FileMode(0644)
+		if inInfo.Mode().IsRegular() {
+			mode = inInfo.Mode().Perm()
+		}
+		if err := f.Chmod(mode); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, err
+		}
+		return f, nil
+	}
+	if info, err := os.Stdout.Stat(); binary && err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return nil, errUsage{"compressed data will not be written to a terminal, use -o or a redirect"}
+	}
+	return os.Stdout, nil
+}
 
-	//get norm bytes
-	size := uint(len(bwtBytes))
-	normBytes := make([]byte, size)
-	bwtComp, err := bwt.NewBWTS()
+// Метод компрессии, в котором используется 4 этапа сжатия BWTS -> MTF -> ZRLE -> Huffman
+// (или арифметическое кодирование).
+// Файл сжимается поблочно, блоки сжимаются параллельно.
+// Пустой путь или "-" означает стандартный ввод или вывод.
+func compress(inputFilePath string, outPutFilePath string, o *fd.Options) (err error) {
+	in, size, err := openInput(inputFilePath)
 	if err != nil {
 		return err
 	}
-	_, _, err = bwtComp.Inverse(bwtBytes, normBytes)
-	check(err)
-	_, _, err = bwtComp.Inverse(bwtBytes, normBytes)
-	check(err)
+	defer in.Close()
 
-	err = ioutil.WriteFile(outPutFilePath, normBytes, 0777)
-	check(err)
-	return nil
+	f, err := createOutput(in, outPutFilePath, true)
+	if err != nil {
+		return err
+	}
+	defer commitOutput(f, outPutFilePath, &err)
+	out := bufio.NewWriter(f)
+	o.Size = uint64(size)
+	w := fd.NewWriter(out, o)
+	// Сжимается ровно size байтов обычного файла: файл, дописываемый во время сжатия
+	// (например, журнал), не нарушает размер, объявленный в заголовке.
+	var src io.Reader = in
+	if size > 0 {
+		src = io.LimitReader(in, size)
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if size > 0 {
+		if n, _ := in.Read(make([]byte, 1)); n > 0 {
+			fmt.Fprintf(os.Stderr, "fd compress: warning: %s grew during compression, only the first %d bytes were compressed\n", inputFilePath, size)
+		}
+	}
+	return out.Flush()
 }
 
+// Метод декомпрессии, все происходит в обратном порядке.
+// Выходной файл создается только после проверки заголовка.
+func decompress(inputFilePath string, outPutFilePath string, o *fd.Options) (err error) {
+	in, _, err := openInput(inputFilePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
 
-func main() {
-	inputFilePath := flag.String("i", "", "a string")
-	outputFilePath := flag.String("o", "", "a string")
-	flag.Parse()
-	if *inputFilePath == "" {
-		panic(errors.New("inputFile path in empty"))
-	}
-	if *outputFilePath == "" {
-		panic(errors.New("outputFilePath path in empty"))
-	}
-
-	//compressor
-	//err := compress(*inputFilePath, *outputFilePath)
-	//if err != nil {
-	//	fmt.Printf("Error while compressing %s", err.Error())
-	//	panic(err)
-	//}
-	//fmt.Printf("Compress successful. Compressed file path is %s\n", *outputFilePath)
-
-	//decompressor
-	err := decompress(*inputFilePath, *outputFilePath)
+	r := fd.NewReaderOptions(in, o)
+	defer r.Close()
+	if _, err = r.Header(); err != nil {
+		return err
+	}
+	f, err := createOutput(in, outPutFilePath, false)
 	if err != nil {
-		fmt.Printf("Error while decompressing %s", err.Error())
-		panic(err)
-	}
-	fmt.Printf("Decompress successful. Decompressed file path is %s\n", *outputFilePath)
-
-
-	// код для удобства тестирования
-
-	//action := os.Args[1]
-	//inputFilePath := os.Args[2]
-	//outputFilePath := os.Args[3]
-	//
-	//action := "compress"
-	//inputFilePath :=  "/Users/faritshamardanov/Downloads/waputf8.txt"
-	//outputFilePath := "/Users/faritshamardanov/go/src/github.com/farit2000/compressor/testData/compress_result_b.fd"
-	//
-	//action := "decompress"
-	//inputFilePath :=  "/Users/faritshamardanov/go/src/github.com/farit2000/compressor/testData/compress_result_b.fd"
-	//outputFilePath := "/Users/faritshamardanov/go/src/github.com/farit2000/compressor/testData/decompress_res.txt"
-	//
-	//switch action {
-	//case "compress":
-	//	err := compress(inputFilePath, outputFilePath)
-	//	if err != nil {
-	//		fmt.Printf("Error while compressing %s", err.Error())
-	//		panic(err)
-	//	}
-	//	fmt.Printf("Compress successful. Compressed file path is %s", outputFilePath)
-	//case "decompress":
-	//	err := decompress(inputFilePath, outputFilePath)
-	//	if err != nil {
-	//		fmt.Printf("Error while decompressing %s", err.Error())
-	//		panic(err)
-	//	}
-	//	fmt.Printf("Decompress successful. Decompressed file path is %s", outputFilePath)
-	//default:
-	//	fmt.Printf("Command %s unsupported", action)
-	//}
-}
\ No newline at end of file
+		return err
+	}
+	defer commitOutput(f, outPutFilePath, &err)
+	out := bufio.NewWriter(f)
+	if _, err = io.Copy(out, r); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// commitOutput закрывает выходной файл и, если *err == nil, переименовывает временный файл в path.
+// При ошибке временный файл удаляется, как у gzip и bzip2, чтобы не оставалось недописанного файла,
+// а существующий файл path остается нетронутым.
+func commitOutput(f *os.File, path string, err *error) {
+	closeErr := f.Close()
+	if isStdio(path) {
+		if *err == nil {
+			*err = closeErr
+		}
+		return
+	}
+	if *err == nil {
+		if *err = closeErr; *err == nil {
+			*err = os.Rename(f.Name(), path)
+		}
+	}
+	if *err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// exitCode возвращает код завершения для ошибки err.
+func exitCode(err error) int {
+	if _, ok := err.(errUsage); ok {
+		return exitUsage
+	}
+	for _, c := range exitCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return exitError
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+	name := os.Args[1]
+	if name == "-h" || name == "-help" || name == "--help" || name == "help" {
+		fmt.Print(usage)
+		os.Exit(exitOK)
+	}
+	for i := range commands {
+		if commands[i].name != name {
+			continue
+		}
+		err := commands[i].run(&commands[i], os.Args[2:])
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fd %s: %v\n", name, err)
+			os.Exit(exitCode(err))
+		}
+		os.Exit(exitOK)
+	}
+	fmt.Fprintf(os.Stderr, "fd: unknown command %q\n\n%s", name, usage)
+	os.Exit(exitUsage)
+}
@@ -1,6 +1,18 @@
 package mtf
 
-import "bytes"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCorrupt возвращается, если номер символа выходит за пределы алфавита
+	// или битовая карта алфавита повреждена.
+	ErrCorrupt = errors.New("mtf: corrupt data")
+	// ErrTruncated возвращается, если битовая карта алфавита обрывается.
+	ErrTruncated = errors.New("mtf: truncated data")
+)
 
 // Алфавит необходимый для работы алгоритма
 type SymbolTable string
@@ -20,33 +32,82 @@ func (symbols SymbolTable) Encode(s []byte) []byte {
 }
 
 // Decode метод декодирования
-func (symbols SymbolTable) Decode(seq []byte) []byte {
+func (symbols SymbolTable) Decode(seq []byte) ([]byte, error) {
 	chars := make([]byte, len(seq))
 	pad := []byte(symbols)
 	for i, x := range seq {
+		if int(x) >= len(pad) {
+			return nil, fmt.Errorf("%w: symbol %d at %d is outside the alphabet of %d symbols", ErrCorrupt, x, i, len(pad))
+		}
 		c := pad[x]
 		chars[i] = c
 		copy(pad[1:], pad[:x])
 		pad[0] = c
 	}
-	return chars
+	return chars, nil
 }
 
-// AlphabetCreate метод постороения алфавита (уникальных) по входной строке
+// AlphabetCreate метод постороения алфавита (уникальных) по входной строке.
+// Символы алфавита упорядочены по возрастанию.
 func AlphabetCreate(input []byte) []byte {
-	var res []byte
+	var used [256]bool
 	for _, b := range input {
-		if !bytes.Contains(res, []byte{b}) {
-			res = append(res, b)
+		used[b] = true
+	}
+	var res []byte
+	for b, ok := range used {
+		if ok {
+			res = append(res, byte(b))
 		}
 	}
 	return res
 }
 
-// GetAlphabet метод получения алфавита (уникальных), так же получаем длину алфавита,
-// так как он закодирован в строке по входной строке
-func GetAlphabet(input []byte) ([]byte, []byte) {
-	num := input[len(input)-1]
-	symbols := input[len(input)-int(num)-1:len(input)-1]
-	return input[:len(input)-int(num)-1], symbols
-}
\ No newline at end of file
+// AppendBitmap дописывает к dst алфавит в виде двухуровневой битовой карты, как в bzip2:
+// 16 бит отмечают используемые диапазоны по 16 значений, затем для каждого используемого
+// диапазона 16 бит отмечают его значения. Старший бит соответствует меньшему значению.
+// Так записывается любой алфавит, включая все 256 значений.
+func AppendBitmap(dst []byte, alphabet []byte) []byte {
+	var ranges uint16
+	var maps [16]uint16
+	for _, b := range alphabet {
+		ranges |= 0x8000 >> (b >> 4)
+		maps[b>>4] |= 0x8000 >> (b & 15)
+	}
+	dst = append(dst, byte(ranges>>8), byte(ranges))
+	for i, m := range maps {
+		if ranges&(0x8000>>i) != 0 {
+			dst = append(dst, byte(m>>8), byte(m))
+		}
+	}
+	return dst
+}
+
+// ReadBitmap читает алфавит, записанный AppendBitmap, из начала src.
+// Возвращает алфавит, упорядоченный по возрастанию, и количество прочитанных байтов.
+func ReadBitmap(src []byte) (alphabet []byte, n int, err error) {
+	if len(src) < 2 {
+		return nil, 0, fmt.Errorf("%w: alphabet bitmap is missing", ErrTruncated)
+	}
+	ranges := uint16(src[0])<<8 | uint16(src[1])
+	n = 2
+	for i := 0; i < 16; i++ {
+		if ranges&(0x8000>>i) == 0 {
+			continue
+		}
+		if len(src) < n+2 {
+			return nil, 0, fmt.Errorf("%w: alphabet bitmap is cut short", ErrTruncated)
+		}
+		m := uint16(src[n])<<8 | uint16(src[n+1])
+		n += 2
+		if m == 0 {
+			return nil, 0, fmt.Errorf("%w: empty range %d in alphabet bitmap", ErrCorrupt, i)
+		}
+		for j := 0; j < 16; j++ {
+			if m&(0x8000>>j) != 0 {
+				alphabet = append(alphabet, byte(i<<4|j))
+			}
+		}
+	}
+	return alphabet, n, nil
+}
@@ -0,0 +1,104 @@
+package mtf
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// allBytes возвращает все 256 значений байта по возрастанию.
+func allBytes() []byte {
+	b := make([]byte, 256)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+func TestBitmap(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		alphabet []byte
+		size     int // Размер битовой карты
+	}{
+		{"empty", nil, 2},
+		{"zero", []byte{0}, 4},
+		{"255", []byte{255}, 4},
+		{"one range", []byte{0x40, 0x41, 0x4f}, 4},
+		{"two ranges", []byte{0x0f, 0xf0}, 6},
+		{"full", allBytes(), 2 + 16*2},
+	} {
+		bitmap := AppendBitmap([]byte{0xaa}, tt.alphabet)
+		if len(bitmap) != 1+tt.size || bitmap[0] != 0xaa {
+			t.Errorf("%s: AppendBitmap wrote % x, want a %d-byte bitmap after the prefix", tt.name, bitmap, tt.size)
+			continue
+		}
+		// Данные после битовой карты не читаются
+		alphabet, n, err := ReadBitmap(append(bitmap[1:], 0xff, 0xff))
+		if err != nil || n != tt.size || !bytes.Equal(alphabet, tt.alphabet) {
+			t.Errorf("%s: ReadBitmap returned %v, %d, %v", tt.name, alphabet, n, err)
+		}
+	}
+}
+
+func TestBitmapErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		bitmap []byte
+		err    error
+	}{
+		{"empty", nil, ErrTruncated},
+		{"one byte", []byte{0x80}, ErrTruncated},
+		{"range map missing", []byte{0x80, 0x01}, ErrTruncated},
+		{"range map cut short", []byte{0x80, 0x00, 0x80}, ErrTruncated},
+		{"last of 16 range maps missing", AppendBitmap(nil, allBytes())[:2+15*2+1], ErrTruncated},
+		{"empty range", []byte{0x80, 0x00, 0x00, 0x00}, ErrCorrupt},
+	} {
+		if _, _, err := ReadBitmap(tt.bitmap); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	full := allBytes()
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"one symbol", bytes.Repeat([]byte{'x'}, 10)},
+		{"text", []byte("bananaaa banana")},
+		{"all bytes", full},
+		{"all bytes reversed", append(full[128:], full[:128]...)},
+		{"binary", append(append(bytes.Repeat([]byte{0}, 5), full...), 255, 0, 255, 128)},
+	} {
+		alphabet := AlphabetCreate(tt.data)
+		seq := SymbolTable(alphabet).Encode(tt.data)
+		for i, x := range seq {
+			if int(x) >= len(alphabet) {
+				t.Fatalf("%s: rank %d at %d is outside the alphabet of %d symbols", tt.name, x, i, len(alphabet))
+			}
+		}
+		got, err := SymbolTable(alphabet).Decode(seq)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Fatalf("%s: data mismatch", tt.name)
+		}
+	}
+	// На входе из всех байтов по возрастанию каждый номер равен самому байту
+	if seq := SymbolTable(full).Encode(full); !bytes.Equal(seq, full) {
+		t.Errorf("all bytes: ranks %v", seq)
+	}
+}
+
+func TestDecodeOutsideAlphabet(t *testing.T) {
+	if _, err := SymbolTable("abc").Decode([]byte{0, 2, 3}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("rank 3 of 3 symbols: got %v, want ErrCorrupt", err)
+	}
+	if _, err := SymbolTable("").Decode([]byte{0}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("rank 0 of an empty alphabet: got %v, want ErrCorrupt", err)
+	}
+}
@@ -1,49 +1,82 @@
 package rle
 
 import (
-	"strconv"
-	"strings"
-	"unicode"
+	"errors"
+	"fmt"
 )
 
-//  RunLengthEncode RLE кодирование, где последовательность одинаковых символов заменяется на их количество и этот символ
-func RunLengthEncode(input string) string {
-	notChangedInput := input
-	var result strings.Builder
-	for len(input) > 0 {
-		firstLetter := input[0]
-		inputLength := len(input)
-		input = strings.TrimLeft(input, string(firstLetter))
-		if counter := inputLength - len(input); counter > 1 {
-			result.WriteString(strconv.Itoa(counter))
-		}
-		result.WriteString(string(firstLetter))
-		// проверяем что становиться не хуже, если хуже то возвращаем строку без изменений
-		if len(result.String()) > len(notChangedInput) {
-			return notChangedInput
+// MinRun - длина серии одинаковых байтов, после которой записывается байт длины продолжения серии.
+const MinRun = 4
+
+// maxExtra - наибольшая длина продолжения серии, умещающаяся в один байт.
+const maxExtra = 255
+
+var (
+	// ErrCorrupt возвращается, если закодированные данные повреждены.
+	ErrCorrupt = errors.New("rle: corrupt data")
+	// ErrTruncated возвращается, если закодированные данные обрываются посреди серии.
+	ErrTruncated = errors.New("rle: truncated data")
+)
+
+// RunLengthEncode RLE кодирование произвольных байтов.
+// Первые MinRun байтов серии записываются как есть, за ними следует байт с количеством
+// оставшихся повторов (0..255), поэтому формат однозначен для любых входных данных.
+// Если кодирование не уменьшает размер, возвращает input без изменений и false:
+// о том, было ли применено RLE, нужно сообщить декодеру вне данных.
+func RunLengthEncode(input []byte) ([]byte, bool) {
+	result := make([]byte, 0, len(input))
+	for i := 0; i < len(input); {
+		b := input[i]
+		run := 1
+		for i+run < len(input) && run < MinRun+maxExtra && input[i+run] == b {
+			run++
+		}
+		i += run
+		if run < MinRun {
+			for ; run > 0; run-- {
+				result = append(result, b)
+			}
+		} else {
+			result = append(result, b, b, b, b, byte(run-MinRun))
+		}
+		// проверяем что становиться не хуже, если хуже то возвращаем данные без изменений
+		if len(result) >= len(input) {
+			return input, false
 		}
 	}
-	result.WriteString("%#%")
-	return result.String()
+	return result, true
 }
 
-// RunLengthDecode метод декодирования RLE, где так жде присуцтвкет проверка на то,
-// был ли ипользован RLE
-func RunLengthDecode(input string) string {
-	last3  := input[len(input)-3:]
-	if last3 == "%#%" {
-		input = input[:len(input)-3]
-		var result strings.Builder
-		for len(input) > 0 {
-			letterIndex := strings.IndexFunc(input, func(r rune) bool { return !unicode.IsDigit(r) })
-			multiply := 1
-			if letterIndex != 0 {
-				multiply, _ = strconv.Atoi(input[:letterIndex])
+// RunLengthDecode метод декодирования RLE.
+// maxSize - наибольший допустимый размер декодированных данных.
+func RunLengthDecode(input []byte, maxSize int) ([]byte, error) {
+	result := make([]byte, 0, maxSize)
+	run := 0
+	for i := 0; i < len(input); i++ {
+		b := input[i]
+		if run > 0 && b == result[len(result)-1] {
+			run++
+		} else {
+			run = 1
+		}
+		result = append(result, b)
+		if run < MinRun {
+			if len(result) > maxSize {
+				return nil, fmt.Errorf("%w: decoded size exceeds %d", ErrCorrupt, maxSize)
 			}
-			result.WriteString(strings.Repeat(string(input[letterIndex]), multiply))
-			input = input[letterIndex+1:]
+			continue
+		}
+		if i++; i == len(input) {
+			return nil, fmt.Errorf("%w: run of %#x has no length", ErrTruncated, b)
 		}
-		return result.String()
+		extra := int(input[i])
+		if len(result)+extra > maxSize {
+			return nil, fmt.Errorf("%w: decoded size exceeds %d", ErrCorrupt, maxSize)
+		}
+		for ; extra > 0; extra-- {
+			result = append(result, b)
+		}
+		run = 0
 	}
-	return input
-}
\ No newline at end of file
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package rle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// maxRun - наибольшая длина серии, которую кодирует одна запись.
+const maxRun = MinRun + maxExtra
+
+// runs возвращает данные из серий байтов b длины n, чередуя b с байтом b+1.
+func runs(b byte, lengths ...int) []byte {
+	var data []byte
+	for i, n := range lengths {
+		data = append(data, bytes.Repeat([]byte{b + byte(i%2)}, n)...)
+	}
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	all := make([]byte, 0, 256*maxRun)
+	for b := 0; b < 256; b++ {
+		all = append(all, bytes.Repeat([]byte{byte(b)}, b+1)...)
+	}
+	for _, tt := range []struct {
+		name string
+		data []byte
+		size int // Размер закодированных данных, -1 - RLE не уменьшает размер
+	}{
+		{"short runs", runs('a', 1, 2, 3, 2, 1, 3), -1},
+		{"min runs only", runs('a', MinRun, MinRun, MinRun), -1},
+		{"min run", runs('a', MinRun, MinRun-1, 100), (MinRun + 1) + (MinRun - 1) + (MinRun + 1)},
+		{"run at the cap", runs('a', maxRun), MinRun + 1},
+		{"run above the cap", runs('a', maxRun+1), MinRun + 2},
+		{"run of two caps", runs('a', 2*maxRun), 2 * (MinRun + 1)},
+		{"run of two caps and min run", runs('a', 2*maxRun+MinRun), 3 * (MinRun + 1)},
+		{"runs of count bytes", runs(MinRun, maxRun, MinRun, 10), 3 * (MinRun + 1)},
+		{"zero and 255", append(runs(0, 300), runs(255, 300)...), 4 * (MinRun + 1)},
+		{"all bytes", all, 1 + 2 + 3 + (256-3)*(MinRun+1)},
+	} {
+		encoded, ok := RunLengthEncode(tt.data)
+		if tt.size == -1 {
+			if ok || !bytes.Equal(encoded, tt.data) {
+				t.Errorf("%s: got %d bytes, %v; want the input unchanged", tt.name, len(encoded), ok)
+			}
+			continue
+		}
+		if !ok {
+			t.Fatalf("%s: RLE did not shrink %d bytes", tt.name, len(tt.data))
+		}
+		if len(encoded) != tt.size {
+			t.Errorf("%s: encoded to %d bytes, want %d", tt.name, len(encoded), tt.size)
+		}
+		got, err := RunLengthDecode(encoded, len(tt.data))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Fatalf("%s: data mismatch", tt.name)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		encoded []byte
+		maxSize int
+		err     error
+	}{
+		{"no run length", []byte("xaaaa"), 100, ErrTruncated},
+		{"literals too long", []byte("abcdef"), 5, ErrCorrupt},
+		{"run too long", []byte{'a', 'a', 'a', 'a', 10}, MinRun + 9, ErrCorrupt},
+	} {
+		if _, err := RunLengthDecode(tt.encoded, tt.maxSize); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.err)
+		}
+	}
+	// Ровно maxSize байтов - не ошибка
+	if got, err := RunLengthDecode([]byte{'a', 'a', 'a', 'a', 10}, MinRun+10); err != nil || len(got) != MinRun+10 {
+		t.Errorf("run of exactly maxSize: got %d bytes, %v", len(got), err)
+	}
+}
@@ -0,0 +1,115 @@
+package zrle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Символы серий нулей. Длина серии записывается в биективной двоичной системе
+// (как в bzip2): RUNA - цифра 1, RUNB - цифра 2, младшие разряды идут первыми.
+const (
+	RUNA = 0
+	RUNB = 1
+)
+
+// AlphabetSize - количество различных символов на выходе Encode:
+// RUNA, RUNB и ненулевые номера MTF 1..255, сдвинутые на 1.
+const AlphabetSize = 257
+
+var (
+	// ErrCorrupt возвращается, если закодированные данные повреждены.
+	ErrCorrupt = errors.New("zrle: corrupt data")
+)
+
+// Encode заменяет серии нулей в выходе MTF символами RUNA/RUNB,
+// а каждый ненулевой номер r - символом r+1.
+func Encode(seq []byte) []uint16 {
+	symbols := make([]uint16, 0, len(seq)/2)
+	run := 0
+	for _, x := range seq {
+		if x == 0 {
+			run++
+			continue
+		}
+		symbols = appendRun(symbols, run)
+		run = 0
+		symbols = append(symbols, uint16(x)+1)
+	}
+	return appendRun(symbols, run)
+}
+
+// appendRun дописывает длину серии нулей n в биективной двоичной системе.
+func appendRun(symbols []uint16, n int) []uint16 {
+	for n > 0 {
+		if n&1 != 0 {
+			symbols = append(symbols, RUNA)
+			n = (n - 1) / 2
+		} else {
+			symbols = append(symbols, RUNB)
+			n = (n - 2) / 2
+		}
+	}
+	return symbols
+}
+
+// Decode восстанавливает выход MTF из символов Encode.
+// maxSize - наибольший допустимый размер декодированных данных.
+func Decode(symbols []uint16, maxSize int) ([]byte, error) {
+	d := NewDecoder(maxSize)
+	for _, s := range symbols {
+		if err := d.WriteSymbol(s); err != nil {
+			return nil, err
+		}
+	}
+	return d.Bytes(), nil
+}
+
+// Decoder восстанавливает выход MTF из символов Encode по одному символу,
+// поэтому символы не нужно накапливать, а поврежденный поток отвергается,
+// как только декодированные данные становятся длиннее maxSize.
+type Decoder struct {
+	seq     []byte
+	maxSize int
+	run     int // Длина текущей серии нулей
+	weight  int // Вес следующей цифры RUNA/RUNB
+}
+
+// NewDecoder создает Decoder, декодирующий не больше maxSize байтов.
+func NewDecoder(maxSize int) *Decoder {
+	return &Decoder{seq: make([]byte, 0, maxSize), maxSize: maxSize, weight: 1}
+}
+
+// WriteSymbol декодирует очередной символ s.
+func (d *Decoder) WriteSymbol(s uint16) error {
+	switch {
+	case s == RUNA || s == RUNB:
+		d.run += d.weight * (int(s) + 1)
+		d.weight <<= 1
+		if d.run > d.maxSize-len(d.seq) {
+			return fmt.Errorf("%w: decoded size exceeds %d", ErrCorrupt, d.maxSize)
+		}
+		return nil
+	case int(s) >= AlphabetSize:
+		return fmt.Errorf("%w: symbol %d is outside the alphabet of %d symbols", ErrCorrupt, s, AlphabetSize)
+	}
+	if d.run+1 > d.maxSize-len(d.seq) {
+		return fmt.Errorf("%w: decoded size exceeds %d", ErrCorrupt, d.maxSize)
+	}
+	d.flushRun()
+	d.seq = append(d.seq, byte(s-1))
+	return nil
+}
+
+// flushRun дописывает накопленную серию нулей.
+func (d *Decoder) flushRun() {
+	for ; d.run > 0; d.run-- {
+		d.seq = append(d.seq, 0)
+	}
+	d.weight = 1
+}
+
+// Bytes завершает последнюю серию нулей и возвращает декодированные данные.
+func (d *Decoder) Bytes() []byte {
+	d.flushRun()
+	return d.seq
+}
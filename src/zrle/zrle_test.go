@@ -0,0 +1,100 @@
+package zrle
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	for _, tt := range []struct {
+		seq     []byte
+		symbols []uint16
+	}{
+		{nil, []uint16{}},
+		{[]byte{0}, []uint16{RUNA}},
+		{[]byte{0, 0}, []uint16{RUNB}},
+		{[]byte{0, 0, 0}, []uint16{RUNA, RUNA}},
+		{[]byte{0, 0, 0, 0}, []uint16{RUNB, RUNA}},
+		{[]byte{0, 0, 0, 0, 0}, []uint16{RUNA, RUNB}},
+		{[]byte{0, 0, 0, 0, 0, 0}, []uint16{RUNB, RUNB}},
+		{[]byte{0, 0, 0, 0, 0, 0, 0}, []uint16{RUNA, RUNA, RUNA}},
+		{[]byte{1, 0, 255, 0, 0}, []uint16{2, RUNA, 256, RUNB}},
+	} {
+		if got := Encode(tt.seq); !equal(got, tt.symbols) {
+			t.Errorf("Encode(%v) = %v, want %v", tt.seq, got, tt.symbols)
+		}
+	}
+}
+
+// equal сравнивает последовательности символов.
+func equal(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRoundTrip(t *testing.T) {
+	// Серии всех длин до 1100, включая 2^k-2, 2^k-1 и 2^k, на которых меняется количество цифр
+	for n := 0; n <= 1100; n++ {
+		for _, seq := range [][]byte{
+			make([]byte, n),
+			append(make([]byte, n), 7),
+			append([]byte{255}, make([]byte, n)...),
+		} {
+			got, err := Decode(Encode(seq), len(seq))
+			if err != nil {
+				t.Fatalf("run of %d: %v", n, err)
+			}
+			if !bytes.Equal(got, seq) {
+				t.Fatalf("run of %d: decoded %v", n, got)
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	seq := append(make([]byte, 100), 1, 2, 0, 0, 3)
+	symbols := Encode(seq)
+	for _, tt := range []struct {
+		name    string
+		symbols []uint16
+		maxSize int
+	}{
+		{"run too long", Encode(make([]byte, 100)), 99},
+		{"literal too long", symbols, len(seq) - 1},
+		{"run before literal too long", Encode(append(make([]byte, 100), 1)), 100},
+		{"symbol outside the alphabet", []uint16{2, AlphabetSize}, 10},
+	} {
+		if _, err := Decode(tt.symbols, tt.maxSize); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: got %v, want ErrCorrupt", tt.name, err)
+		}
+	}
+}
+
+func TestDecoderStops(t *testing.T) {
+	// Поврежденный поток из одних цифр серии отвергается через log2(maxSize) символов,
+	// а поток из одних литералов - сразу после maxSize символов
+	const maxSize = 1 << 20
+	for _, s := range []uint16{RUNA, RUNB, 5} {
+		d := NewDecoder(maxSize)
+		n := 0
+		for ; n <= maxSize; n++ {
+			if err := d.WriteSymbol(s); err != nil {
+				if !errors.Is(err, ErrCorrupt) {
+					t.Fatalf("symbol %d: got %v, want ErrCorrupt", s, err)
+				}
+				break
+			}
+		}
+		if s != 5 && n > 21 || s == 5 && n != maxSize {
+			t.Errorf("symbol %d: rejected after %d symbols", s, n)
+		}
+	}
+}